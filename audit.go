@@ -0,0 +1,329 @@
+package rgwspublic
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrAuditTampered is matched by every AuditError
+var ErrAuditTampered = errors.New("audit log has been tampered with")
+
+// AuditError locates the first entry of an audit log failing verification
+type AuditError struct {
+	Line   int   // 1-based line of the file
+	Seq    int64 // sequence the entry should have
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit log line %d (seq %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// Is makes every AuditError an ErrAuditTampered
+func (e *AuditError) Is(target error) bool {
+	return target == ErrAuditTampered
+}
+
+// AuditWriteError is returned by a lookup that could not be recorded in the audit log
+// the lookup itself may have succeeded, Lookup and LookupFor return no info then,
+// LookupResponse returns the exchange along, with its info
+type AuditWriteError struct {
+	Err error
+}
+
+func (e *AuditWriteError) Error() string {
+	return "audit log: " + e.Err.Error()
+}
+
+// Unwrap returns the write error
+func (e *AuditWriteError) Unwrap() error {
+	return e.Err
+}
+
+// AuditEntry is a lookup as recorded in the audit log
+// Seq and Prev chain it to the entry before, and are set by Append
+type AuditEntry struct {
+	Seq       int64       `json:"seq"`
+	Prev      string      `json:"prev"` // hash of the previous entry, empty for the first
+	Time      time.Time   `json:"time"`
+	Actor     string      `json:"actor,omitempty"`   // who asked, e.g. a user of the application
+	Purpose   string      `json:"purpose,omitempty"` // why, e.g. onboarding or an invoice number
+	CalledBy  string      `json:"called_by,omitempty"`
+	AFM       string      `json:"afm"`
+	CallSeqID int         `json:"call_seq_id,omitempty"` // identifies the call at AADE
+	Identity  VATCalledBy `json:"identity"`              // as echoed by the service
+	Raw       string      `json:"raw,omitempty"`         // soap response as received
+	Info      *VATInfo    `json:"info,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// auditLine is a line of the log, hash is the sha-256 of the entry bytes
+// and mac their HMAC-SHA256 with the log key
+type auditLine struct {
+	Entry json.RawMessage `json:"entry"`
+	Hash  string          `json:"hash"`
+	MAC   string          `json:"mac"`
+}
+
+// AuditLog is an append-only, tamper-evident log of lookups in a jsonl file
+// each entry holds the hash of the one before and is authenticated with a key,
+// so VerifyAudit detects modified, inserted or deleted entries
+// deleting the last entries is detected by comparing Head with a copy kept elsewhere
+type AuditLog struct {
+	key []byte
+
+	mu   sync.Mutex
+	f    *os.File
+	seq  int64
+	head string
+}
+
+// OpenAuditLog opens or creates the audit log at path
+// the existing entries are verified first, a broken log is not appended to
+// a last line left incomplete by a crash while appending is refused too, see RepairAuditLog
+func OpenAuditLog(path string, key []byte) (*AuditLog, error) {
+
+	if len(key) == 0 {
+		return nil, errors.New("audit log needs a key")
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	n, head, err := VerifyAudit(f, key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &AuditLog{key: key, f: f, seq: n, head: head}, nil
+}
+
+// Append chains and writes an entry, Time is set to now if zero
+func (l *AuditLog) Append(e AuditEntry) (*AuditEntry, error) {
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.AFM = strings.TrimSpace(e.AFM)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq, e.Prev = l.seq+1, l.head
+
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := auditHash(entry)
+	b, err := json.Marshal(auditLine{Entry: entry, Hash: hash, MAC: auditMAC(l.key, hash)})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	if err := l.f.Sync(); err != nil {
+		return nil, err
+	}
+
+	l.seq, l.head = e.Seq, hash
+	return &e, nil
+}
+
+// Record appends a lookup made by a client
+func (l *AuditLog) Record(actor, purpose, calledby, afm string, info *VATInfo, raw []byte, err error) error {
+
+	e := AuditEntry{Actor: actor, Purpose: purpose, CalledBy: calledby, AFM: afm, Raw: string(raw), Info: info}
+	if info != nil {
+		e.CallSeqID, e.Identity = info.CallSeqID, info.CalledBy
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	_, err = l.Append(e)
+	return err
+}
+
+// Head returns the sequence and hash of the last entry
+// keep them elsewhere to detect deletion of the last entries
+func (l *AuditLog) Head() (int64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.head
+}
+
+// Close the log file
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// VerifyAudit checks every entry of an audit log, its hash, its mac and its link to the one before
+// returns the number of entries and the hash of the last one, or an *AuditError
+func VerifyAudit(r io.Reader, key []byte) (int64, string, error) {
+	return verifyAudit(r, key, nil)
+}
+
+// VerifyAuditHead is VerifyAudit also checking the entry seq has the hash kept by Head,
+// so a tail rewritten or deleted and appended to since is detected
+func VerifyAuditHead(r io.Reader, key []byte, seq int64, hash string) (int64, string, error) {
+
+	n, head, err := verifyAudit(r, key, func(line int, s int64, h string) error {
+		if s == seq && h != hash {
+			return &AuditError{Line: line, Seq: s, Reason: "hash differs from the kept head, entries were rewritten"}
+		}
+		return nil
+	})
+	if err != nil {
+		return n, head, err
+	}
+
+	if n < seq {
+		return n, head, &AuditError{Line: int(n) + 1, Seq: n + 1, Reason: fmt.Sprintf("head kept at seq %d, entries were deleted", seq)}
+	}
+	if seq == 0 && hash != "" {
+		return n, head, &AuditError{Line: 1, Seq: 1, Reason: "head kept without a seq"}
+	}
+
+	return n, head, nil
+}
+
+// verifyAudit verifies a log, calling entry, if not nil, for each verified entry
+func verifyAudit(r io.Reader, key []byte, entry func(line int, seq int64, hash string) error) (int64, string, error) {
+
+	var seq int64
+	head := ""
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+
+		b, err := br.ReadBytes('\n')
+		if err == io.EOF && len(b) == 0 {
+			return seq, head, nil
+		}
+		if err != nil && err != io.EOF {
+			return seq, head, err
+		}
+
+		fail := func(reason string) (int64, string, error) {
+			return seq, head, &AuditError{Line: line, Seq: seq + 1, Reason: reason}
+		}
+
+		if !bytes.HasSuffix(b, []byte("\n")) {
+			return fail("incomplete last line")
+		}
+
+		var al auditLine
+		if err := json.Unmarshal(b, &al); err != nil {
+			return fail("not an audit entry: " + err.Error())
+		}
+		if auditHash(al.Entry) != al.Hash {
+			return fail("entry was modified, hash doesn't match")
+		}
+		if !hmac.Equal([]byte(auditMAC(key, al.Hash)), []byte(al.MAC)) {
+			return fail("entry not authenticated by the key")
+		}
+
+		var e AuditEntry
+		if err := json.Unmarshal(al.Entry, &e); err != nil {
+			return fail("not an audit entry: " + err.Error())
+		}
+		if e.Seq != seq+1 {
+			return fail(fmt.Sprintf("found seq %d, entries were deleted or reordered", e.Seq))
+		}
+		if e.Prev != head {
+			return fail("previous hash doesn't match, entries were deleted or reordered")
+		}
+
+		if entry != nil {
+			if err := entry(line, e.Seq, al.Hash); err != nil {
+				return seq, head, err
+			}
+		}
+
+		seq, head = e.Seq, al.Hash
+	}
+}
+
+// RepairAuditLog fixes the last line of an audit log left incomplete by a crash while appending
+// a last entry missing only its newline is completed, a partial one is removed,
+// and only if every entry before it verifies; returns whether the log was changed
+func RepairAuditLog(path string, key []byte) (bool, error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if len(b) == 0 || b[len(b)-1] == '\n' {
+		return false, nil
+	}
+
+	// the entries before the incomplete line
+	cut := bytes.LastIndexByte(b, '\n') + 1
+	if _, _, err := VerifyAudit(bytes.NewReader(b[:cut]), key); err != nil {
+		return false, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0600)
+	if err != nil {
+		return false, err
+	}
+
+	if _, _, err := VerifyAudit(bytes.NewReader(append(b, '\n')), key); err == nil {
+		_, err = f.WriteAt([]byte("\n"), int64(len(b)))
+	} else {
+		err = f.Truncate(int64(cut))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err == nil, err
+}
+
+// VerifyAuditFile runs VerifyAudit on the file at path
+func VerifyAuditFile(path string, key []byte) (int64, string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	return VerifyAudit(f, key)
+}
+
+func auditHash(entry []byte) string {
+	sum := sha256.Sum256(entry)
+	return hex.EncodeToString(sum[:])
+}
+
+func auditMAC(key []byte, hash string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(hash))
+	return hex.EncodeToString(m.Sum(nil))
+}
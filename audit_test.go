@@ -0,0 +1,222 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testAuditKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestAuditLog(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := OpenAuditLog(path, testAuditKey)
+	if err != nil {
+		t.Fatalf("error opening audit log: %s", err)
+	}
+
+	c := newTestClient(t, respond(testVATInfoResponse))
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.Audit = a
+
+	if _, err := c.LookupFor("maria", "onboarding", "", "094014298"); err != nil {
+		t.Fatalf("error looking up: %s", err)
+	}
+	if _, err := c.Lookup("", "094014298"); err != nil {
+		t.Fatalf("error looking up: %s", err)
+	}
+	a.Close()
+
+	// appending after reopening continues the chain
+	a, err = OpenAuditLog(path, testAuditKey)
+	if err != nil {
+		t.Fatalf("error reopening audit log: %s", err)
+	}
+	e, err := a.Append(AuditEntry{Actor: "job", AFM: "090165560"})
+	if err != nil {
+		t.Fatalf("error appending: %s", err)
+	}
+	if e.Seq != 3 {
+		t.Errorf("unexpected seq: %d", e.Seq)
+	}
+	seq, head := a.Head()
+	a.Close()
+
+	n, h, err := VerifyAuditFile(path, testAuditKey)
+	if err != nil || n != 3 || h != head || seq != 3 {
+		t.Fatalf("unexpected verification: %d %s %v", n, h, err)
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.SplitAfter(string(b), "\n")
+	if !strings.Contains(lines[0], `"purpose":"onboarding"`) || !strings.Contains(lines[0], `"call_seq_id":46447592`) ||
+		!strings.Contains(lines[0], "rg_ws_public2_result_rtType") {
+		t.Errorf("first entry misses purpose, call seq id or raw response: %s", lines[0])
+	}
+
+	// modified, deleted, reordered and forged entries
+	tampered := map[string]string{
+		"modified": strings.Replace(string(b), "maria", "maris", 1),
+		"deleted":  lines[0] + lines[2],
+		"first":    lines[1] + lines[2],
+		"swapped":  lines[1] + lines[0] + lines[2],
+		"cut":      lines[0] + lines[1] + strings.TrimSuffix(lines[2], "\n"),
+	}
+	for name, log := range tampered {
+		_, _, err := VerifyAudit(strings.NewReader(log), testAuditKey)
+		if !errors.Is(err, ErrAuditTampered) {
+			t.Errorf("%s: tampering not detected: %v", name, err)
+		}
+	}
+
+	if _, _, err := VerifyAudit(bytes.NewReader(b), []byte("another key")); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("entries verified with the wrong key")
+	}
+
+	var aerr *AuditError
+	_, _, err = VerifyAudit(strings.NewReader(tampered["deleted"]), testAuditKey)
+	if !errors.As(err, &aerr) || aerr.Line != 2 || aerr.Seq != 2 {
+		t.Errorf("unexpected error location: %v", err)
+	}
+
+	// a broken log is not appended to
+	if err := ioutil.WriteFile(path, []byte(tampered["modified"]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenAuditLog(path, testAuditKey); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("opened a tampered log: %v", err)
+	}
+}
+
+func TestAuditRepair(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := OpenAuditLog(path, testAuditKey)
+	if err != nil {
+		t.Fatalf("error opening audit log: %s", err)
+	}
+	for _, afm := range []string{"094014298", "090165560"} {
+		if _, err := a.Append(AuditEntry{Actor: "job", AFM: afm}); err != nil {
+			t.Fatalf("error appending: %s", err)
+		}
+	}
+	a.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	tests := []struct {
+		name    string
+		log     string
+		entries int64
+	}{
+		{"partial", string(b) + `{"entry":{"seq":3`, 2},
+		{"newline", strings.TrimSuffix(string(b), "\n"), 2},
+	}
+
+	for _, tt := range tests {
+		ioutil.WriteFile(path, []byte(tt.log), 0600)
+		if _, err := OpenAuditLog(path, testAuditKey); !errors.Is(err, ErrAuditTampered) {
+			t.Errorf("%s: opened a torn log: %v", tt.name, err)
+		}
+
+		if changed, err := RepairAuditLog(path, testAuditKey); err != nil || !changed {
+			t.Fatalf("%s: error repairing: %v", tt.name, err)
+		}
+		if n, _, err := VerifyAuditFile(path, testAuditKey); err != nil || n != tt.entries {
+			t.Errorf("%s: unexpected entries after repair: %d, %v", tt.name, n, err)
+		}
+		if changed, _ := RepairAuditLog(path, testAuditKey); changed {
+			t.Errorf("%s: repaired twice", tt.name)
+		}
+	}
+
+	// a tampered entry before the last line is not repaired
+	ioutil.WriteFile(path, []byte(strings.Replace(string(b), "job", "bob", 1)+"{"), 0600)
+	if _, err := RepairAuditLog(path, testAuditKey); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("repaired a tampered log: %v", err)
+	}
+}
+
+func TestClientAuditFailures(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := OpenAuditLog(path, testAuditKey)
+	if err != nil {
+		t.Fatalf("error opening audit log: %s", err)
+	}
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.Audit = a
+
+	// failed calls are recorded
+	if _, err := c.Lookup("", "094014298"); err == nil {
+		t.Fatalf("expected an http error")
+	}
+	b, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(b), `"afm":"094014298"`) || !strings.Contains(string(b), "HTTP Status: 503") {
+		t.Errorf("failed call not audited: %s", b)
+	}
+
+	// failing to record a lookup fails it
+	c = newTestClient(t, respond(testVATInfoResponse))
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.Audit = a
+	a.Close()
+
+	var werr *AuditWriteError
+	if _, err := c.Lookup("", "094014298"); !errors.As(err, &werr) {
+		t.Errorf("expected an audit write error, got: %v", err)
+	}
+}
+
+func TestVerifyAuditHead(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := OpenAuditLog(path, testAuditKey)
+	if err != nil {
+		t.Fatalf("error opening audit log: %s", err)
+	}
+	a.Append(AuditEntry{Actor: "job", AFM: "094014298"})
+	a.Append(AuditEntry{Actor: "job", AFM: "090165560"})
+	seq, head := a.Head()
+	a.Append(AuditEntry{Actor: "job", AFM: "094019245"})
+	a.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	if n, _, err := VerifyAuditHead(bytes.NewReader(b), testAuditKey, seq, head); err != nil || n != 3 {
+		t.Errorf("grown log failed verification: %d %v", n, err)
+	}
+
+	// the tail rewritten and appended to since
+	lines := strings.SplitAfter(string(b), "\n")
+	rewritten := filepath.Join(t.TempDir(), "rewritten.jsonl")
+	ioutil.WriteFile(rewritten, []byte(lines[0]), 0600)
+	a, err = OpenAuditLog(rewritten, testAuditKey)
+	if err != nil {
+		t.Fatalf("error opening audit log: %s", err)
+	}
+	a.Append(AuditEntry{Actor: "job", AFM: "094019245"})
+	a.Append(AuditEntry{Actor: "job", AFM: "094019245"})
+	a.Close()
+
+	var aerr *AuditError
+	b, _ = ioutil.ReadFile(rewritten)
+	if _, _, err := VerifyAudit(bytes.NewReader(b), testAuditKey); err != nil {
+		t.Fatalf("rewritten log should verify on its own: %v", err)
+	}
+	if _, _, err := VerifyAuditHead(bytes.NewReader(b), testAuditKey, seq, head); !errors.As(err, &aerr) || aerr.Line != 2 {
+		t.Errorf("rewritten tail not detected: %v", err)
+	}
+
+	// entries cut from the end
+	if _, _, err := VerifyAuditHead(strings.NewReader(lines[0]), testAuditKey, seq, head); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("deleted tail not detected: %v", err)
+	}
+}
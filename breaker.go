@@ -0,0 +1,234 @@
+package rgwspublic
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit open, the service is failing")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // calls go through
+	CircuitOpen                         // calls fail fast with ErrCircuitOpen
+	CircuitHalfOpen                     // a Version call probes whether the service recovered
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker fails calls fast while the service is failing, instead of waiting for timeouts
+// transport errors, 5xx responses and RG_WS_PUBLIC_SERVICE_NOT_ACTIVE are failures,
+// service errors about the request, like RG_WS_PUBLIC_TAXPAYER_NF, are not
+// the zero value is usable, a breaker can be shared by clients of the same endpoint
+type CircuitBreaker struct {
+	// FailureRate of calls from which the circuit opens, 0.5 if zero
+	FailureRate float64
+
+	// MinCalls in a window before the failure rate counts, 10 if zero
+	MinCalls int
+
+	// Window in which calls are counted, a minute if zero
+	Window time.Duration
+
+	// OpenTimeout before a probe is tried, 30 seconds if zero
+	OpenTimeout time.Duration
+
+	// OnStateChange is called on every change of state, can be nil
+	OnStateChange func(from, to CircuitState)
+
+	mu          sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	calls       int
+	failures    int
+	openedAt    time.Time
+	now         func() time.Time
+}
+
+// State returns the current state of the circuit
+func (b *CircuitBreaker) State() CircuitState {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// admit lets a call of c through, probing the service with Version once the open timeout passed
+// the probe doesn't go through the breaker, but hooks and metrics see it
+func (b *CircuitBreaker) admit(c *Client) error {
+
+	probe, err := b.allow()
+	if err != nil || !probe {
+		return err
+	}
+
+	p := *c
+	p.Breaker = nil
+	_, err = p.Version()
+	b.probed(err == nil)
+	if err != nil {
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// allow reports whether a call can go through and whether it must probe first
+func (b *CircuitBreaker) allow() (bool, error) {
+
+	b.mu.Lock()
+	now := b.clock()
+
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.openTimeout() {
+			b.mu.Unlock()
+			return false, ErrCircuitOpen
+		}
+		from := b.set(CircuitHalfOpen, now)
+		b.mu.Unlock()
+		b.changed(from, CircuitHalfOpen)
+		return true, nil
+
+	case CircuitHalfOpen:
+		// another call is probing
+		b.mu.Unlock()
+		return false, ErrCircuitOpen
+	}
+
+	b.mu.Unlock()
+	return false, nil
+}
+
+// probed closes the circuit if the probe succeeded, or opens it again
+func (b *CircuitBreaker) probed(ok bool) {
+
+	to := CircuitOpen
+	if ok {
+		to = CircuitClosed
+	}
+
+	b.mu.Lock()
+	from := b.set(to, b.clock())
+	b.mu.Unlock()
+
+	b.changed(from, to)
+}
+
+// record counts a call made while closed, opening the circuit at the failure rate
+func (b *CircuitBreaker) record(failure bool) {
+
+	b.mu.Lock()
+	if b.state != CircuitClosed {
+		// the circuit opened while the call was made
+		b.mu.Unlock()
+		return
+	}
+
+	now := b.clock()
+	if now.Sub(b.windowStart) >= b.window() {
+		b.windowStart, b.calls, b.failures = now, 0, 0
+	}
+
+	b.calls++
+	if failure {
+		b.failures++
+	}
+
+	if b.calls < b.minCalls() || float64(b.failures)/float64(b.calls) < b.failureRate() {
+		b.mu.Unlock()
+		return
+	}
+
+	from := b.set(CircuitOpen, now)
+	b.mu.Unlock()
+	b.changed(from, CircuitOpen)
+}
+
+// set changes the state and starts counting again, b.mu must be held
+func (b *CircuitBreaker) set(to CircuitState, now time.Time) CircuitState {
+
+	from := b.state
+	b.state = to
+	b.windowStart, b.calls, b.failures = now, 0, 0
+	if to == CircuitOpen {
+		b.openedAt = now
+	}
+
+	return from
+}
+
+// changed calls OnStateChange, without holding b.mu so it may call State
+func (b *CircuitBreaker) changed(from, to CircuitState) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
+
+func (b *CircuitBreaker) failureRate() float64 {
+	if b.FailureRate <= 0 {
+		return 0.5
+	}
+	return b.FailureRate
+}
+
+func (b *CircuitBreaker) minCalls() int {
+	if b.MinCalls <= 0 {
+		return 10
+	}
+	return b.MinCalls
+}
+
+func (b *CircuitBreaker) window() time.Duration {
+	if b.Window <= 0 {
+		return time.Minute
+	}
+	return b.Window
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if b.OpenTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return b.OpenTimeout
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// circuitFailure reports whether a call means the service is failing
+func circuitFailure(body *XMLBody, resp *Response, err error) bool {
+
+	// no response at all, or a response cut short
+	if resp == nil {
+		return err != nil
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	if err != nil {
+		var perr *ParseError
+		return resp.StatusCode == http.StatusOK && !errors.As(err, &perr)
+	}
+
+	return body != nil && body.VATInfo.Error != nil && body.VATInfo.Error.Code == "RG_WS_PUBLIC_SERVICE_NOT_ACTIVE"
+}
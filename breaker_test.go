@@ -0,0 +1,148 @@
+package rgwspublic
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// breakerService answers lookups with the current body, 503 if empty, and counts version calls
+type breakerService struct {
+	body     atomic.Value
+	lookups  int32
+	versions int32
+}
+
+func (s *breakerService) handle(w http.ResponseWriter, r *http.Request) {
+
+	b, _ := ioutil.ReadAll(r.Body)
+	body, _ := s.body.Load().(string)
+	if strings.Contains(string(b), "rgWsPublic2VersionInfo") {
+		atomic.AddInt32(&s.versions, 1)
+		if body != "" {
+			body = testVersionResponse
+		}
+	} else {
+		atomic.AddInt32(&s.lookups, 1)
+	}
+
+	if body == "" {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	respond(body)(w, r)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+
+	s := &breakerService{}
+	s.body.Store("")
+
+	now := time.Date(2021, 11, 22, 10, 0, 0, 0, time.UTC)
+	var changes []string
+	b := &CircuitBreaker{
+		MinCalls:    4,
+		OpenTimeout: time.Minute,
+		OnStateChange: func(from, to CircuitState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+		now: func() time.Time { return now },
+	}
+
+	c := newTestClient(t, s.handle)
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.Breaker = b
+
+	for i := 0; i < 4; i++ {
+		if _, err := c.Lookup("", "094014298"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected an http error, got: %v", err)
+		}
+	}
+	if b.State() != CircuitOpen {
+		t.Fatalf("circuit not open after failures: %s", b.State())
+	}
+
+	// fails fast without calling the service
+	if _, err := c.Lookup("", "094014298"); !errors.Is(err, ErrCircuitOpen) || s.lookups != 4 {
+		t.Errorf("expected a fast failure, got: %v after %d lookups", err, s.lookups)
+	}
+
+	// a failed probe opens the circuit again
+	now = now.Add(time.Minute)
+	if _, err := c.Lookup("", "094014298"); !errors.Is(err, ErrCircuitOpen) || s.versions != 1 || s.lookups != 4 {
+		t.Errorf("expected a failed probe, got: %v, %d probes", err, s.versions)
+	}
+
+	// a successful probe closes it and lets the call through
+	s.body.Store(testVATInfoResponse)
+	now = now.Add(time.Minute)
+	if _, err := c.Lookup("", "094014298"); err != nil || s.versions != 2 || s.lookups != 5 {
+		t.Errorf("expected the probe and lookup to succeed, got: %v, %d probes", err, s.versions)
+	}
+
+	want := "closed>open open>half-open half-open>open open>half-open half-open>closed"
+	if strings.Join(changes, " ") != want {
+		t.Errorf("unexpected state changes: %v", changes)
+	}
+}
+
+func TestCircuitBreakerFailures(t *testing.T) {
+
+	tests := []struct {
+		body string
+		open bool
+	}{
+		{testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF"), false},
+		{testErrorResponse("RG_WS_PUBLIC_WRONG_AFM"), false},
+		{testErrorResponse("RG_WS_PUBLIC_SERVICE_NOT_ACTIVE"), true},
+	}
+
+	for _, tt := range tests {
+		b := &CircuitBreaker{MinCalls: 3}
+		c := newTestClient(t, respond(tt.body))
+		c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+		c.Breaker = b
+
+		for i := 0; i < 5; i++ {
+			c.Lookup("", "094014298")
+		}
+		if open := b.State() == CircuitOpen; open != tt.open {
+			t.Errorf("%s: circuit is %s", tt.body[strings.Index(tt.body, "<error_code>"):strings.Index(tt.body, "</error_code>")], b.State())
+		}
+	}
+
+	// transport errors, with no response, are failures too
+	if !circuitFailure(nil, nil, errors.New("connection refused")) {
+		t.Errorf("transport error not counted as a failure")
+	}
+	if circuitFailure(nil, &Response{StatusCode: http.StatusOK}, &ParseError{Err: ErrMalformedXML}) {
+		t.Errorf("malformed response counted as a failure")
+	}
+}
+
+func TestCircuitBreakerRate(t *testing.T) {
+
+	now := time.Date(2021, 11, 22, 10, 0, 0, 0, time.UTC)
+	b := &CircuitBreaker{MinCalls: 4, FailureRate: 0.5, Window: time.Minute, now: func() time.Time { return now }}
+
+	// below the rate
+	for _, failure := range []bool{true, false, false, false, true} {
+		b.record(failure)
+	}
+	if b.State() != CircuitClosed {
+		t.Errorf("circuit opened below the failure rate")
+	}
+
+	// a new window forgets the earlier calls
+	now = now.Add(time.Minute)
+	for _, failure := range []bool{false, true, true, true} {
+		b.record(failure)
+	}
+	if b.State() != CircuitOpen {
+		t.Errorf("circuit not opened at the failure rate")
+	}
+}
@@ -0,0 +1,54 @@
+package rgwspublic
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// greek legacy charsets, by their IANA names and aliases
+var greekCharsets = map[string]*charmap.Charmap{
+	"iso-8859-7":      charmap.ISO8859_7,
+	"iso8859-7":       charmap.ISO8859_7,
+	"iso_8859-7":      charmap.ISO8859_7,
+	"iso_8859-7:1987": charmap.ISO8859_7,
+	"iso-ir-126":      charmap.ISO8859_7,
+	"elot_928":        charmap.ISO8859_7,
+	"ecma-118":        charmap.ISO8859_7,
+	"greek":           charmap.ISO8859_7,
+	"greek8":          charmap.ISO8859_7,
+	"csisolatingreek": charmap.ISO8859_7,
+	"windows-1253":    charmap.Windows1253,
+	"cp1253":          charmap.Windows1253,
+	"x-cp1253":        charmap.Windows1253,
+}
+
+// charsetReader converts input in the named charset to UTF-8, for the CharsetReader of xml.Decoder
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+
+	label = strings.ToLower(strings.TrimSpace(label))
+	switch label {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	}
+
+	if cm, ok := greekCharsets[label]; ok {
+		return cm.NewDecoder().Reader(input), nil
+	}
+
+	return nil, fmt.Errorf("unsupported charset %q", label)
+}
+
+// contentCharset returns the charset parameter of a content type, empty if there is none
+func contentCharset(ct string) string {
+
+	_, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(params["charset"]))
+}
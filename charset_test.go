@@ -0,0 +1,96 @@
+package rgwspublic
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// testEncoded returns the vat info response in a legacy charset, with the given declaration
+func testEncoded(t *testing.T, cm *charmap.Charmap, declaration string) string {
+
+	body := strings.Replace(testVATInfoResponse, `<?xml version="1.0" encoding="UTF-8"?>`, declaration, 1)
+	s, err := cm.NewEncoder().String(body)
+	if err != nil {
+		t.Fatalf("error encoding response: %s", err)
+	}
+
+	return s
+}
+
+func TestDecodeDeclaredCharset(t *testing.T) {
+
+	for name, cm := range map[string]*charmap.Charmap{"ISO-8859-7": charmap.ISO8859_7, "windows-1253": charmap.Windows1253} {
+		body := testEncoded(t, cm, `<?xml version="1.0" encoding="`+name+`"?>`)
+		if !strings.Contains(body, "\xd4\xd1\xc1\xd0\xc5\xc6\xc1") {
+			t.Fatalf("%s: response not encoded", name)
+		}
+
+		b, err := decodeXML([]byte(body))
+		if err != nil {
+			t.Errorf("%s: error decoding: %s", name, err)
+			continue
+		}
+		if b.VATInfo.Result.Onomasia != "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ" || b.VATInfo.Activities[1].KindDescr != "ΔΕΥΤΕΡΕΥΟΥΣΑ" {
+			t.Errorf("%s: unexpected info: %+v", name, b.VATInfo.Result)
+		}
+	}
+}
+
+func TestLookupContentTypeCharset(t *testing.T) {
+
+	// the content type wins over a declaration claiming UTF-8
+	body := testEncoded(t, charmap.Windows1253, `<?xml version="1.0" encoding="UTF-8"?>`)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/soap+xml; charset=windows-1253")
+		w.Write([]byte(body))
+	})
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+
+	r, err := c.LookupResponse("", "094014298")
+	if err != nil {
+		t.Fatalf("error looking up: %s", err)
+	}
+	if r.Info.Result.DOYDescription != "ΦΑΕ ΑΘΗΝΩΝ" || r.Info.CalledBy.TokenAFMFullName != "ΠΑΠΑΔΟΠΟΥΛΟΣ ΓΕΩΡΓΙΟΣ" {
+		t.Errorf("unexpected info: %+v", r.Info.Result)
+	}
+	if string(r.Raw) != body {
+		t.Errorf("raw response was converted")
+	}
+}
+
+func TestLookupContentTypeUTF8(t *testing.T) {
+
+	// an explicit utf-8 wins over a declaration of a greek charset
+	body := strings.Replace(testVATInfoResponse, `encoding="UTF-8"`, `encoding="ISO-8859-7"`, 1)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		w.Write([]byte(body))
+	})
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+
+	i, err := c.Lookup("", "094014298")
+	if err != nil {
+		t.Fatalf("error looking up: %s", err)
+	}
+	if i.Result.Onomasia != "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ" {
+		t.Errorf("utf-8 decoded as the declared charset: %q", i.Result.Onomasia)
+	}
+}
+
+func TestUnsupportedCharset(t *testing.T) {
+
+	body := strings.Replace(testVATInfoResponse, `encoding="UTF-8"`, `encoding="KOI8-R"`, 1)
+	if _, err := decodeXML([]byte(body)); err == nil {
+		t.Errorf("expected an error for an unsupported charset")
+	}
+
+	if _, err := charsetReader("windows-1252", strings.NewReader("")); err == nil {
+		t.Errorf("expected an error for windows-1252")
+	}
+	if contentCharset("text/xml; charset=ISO-8859-7") != "iso-8859-7" || contentCharset("text/xml") != "" {
+		t.Errorf("unexpected content type charsets")
+	}
+}
@@ -0,0 +1,221 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operation names, used to label metrics and passed to hooks
+const (
+	OpVersion    = "version"
+	OpGetVATInfo = "get_vat_info"
+)
+
+// Client calls the GSIS service
+// the zero value is usable and talks to the production Endpoint
+type Client struct {
+	// HTTPClient used for requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+
+	// Endpoint of the service, the package Endpoint if empty
+	Endpoint string
+
+	// VIESEndpoint of the EU VIES service, the package VIESEndpoint if empty
+	VIESEndpoint string
+
+	// Credentials used by Lookup, can be nil
+	Credentials CredentialsProvider
+
+	// OnBehalfOf is the AFM the credentials act for, when no called by AFM is given
+	// the service must echo it back, or calls fail with a DelegationError
+	OnBehalfOf string
+
+	// History records every lookup the service answered, can be nil
+	History *History
+
+	// Audit records every lookup the service answered with its raw response, can be nil
+	Audit *AuditLog
+
+	// Metrics is updated on every call, can be nil
+	Metrics *Metrics
+
+	// Hooks are called around every call, can be nil
+	Hooks Hooks
+
+	// Middleware wraps the transport of HTTPClient, first one is outermost
+	Middleware []Middleware
+
+	// MaxResponseSize is the largest response body read, DefaultMaxResponseSize if zero
+	MaxResponseSize int64
+
+	// Breaker fails calls fast while the service is failing, can be nil
+	Breaker *CircuitBreaker
+}
+
+// DefaultClient is used by the package level functions
+var DefaultClient = &Client{}
+
+// NewClient returns a client for the production endpoint
+func NewClient() *Client {
+	return NewClientFor(Production)
+}
+
+func (c *Client) httpClient() *http.Client {
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	if len(c.Middleware) == 0 {
+		return hc
+	}
+
+	// a shallow copy, so the caller's client is left untouched
+	wrapped := *hc
+	wrapped.Transport = Chain(hc.Transport, c.Middleware...)
+	return &wrapped
+}
+
+func (c *Client) endpoint() string {
+	if c.Endpoint == "" {
+		return Endpoint
+	}
+	return c.Endpoint
+}
+
+// call posts a soap envelope to the endpoint and parses the response
+// the exchange is returned too, unless the request could not be sent
+func (c *Client) call(body string) (*XMLBody, *Response, error) {
+
+	if c.Breaker == nil {
+		return c.send(body)
+	}
+
+	if err := c.Breaker.admit(c); err != nil {
+		return nil, nil, err
+	}
+
+	xmlBody, resp, err := c.send(body)
+	c.Breaker.record(circuitFailure(xmlBody, resp, err))
+	return xmlBody, resp, err
+}
+
+// send posts a soap envelope to the endpoint, past the breaker
+func (c *Client) send(body string) (*XMLBody, *Response, error) {
+
+	xmlResp := XMLResponse{}
+	resp, err := c.post(c.endpoint(), "application/soap+xml", body, &xmlResp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = statusError(resp.StatusCode, nil)
+
+		// soap faults come with a 500, their body labels the failure
+		if xmlResp.Body.Error != nil && xmlResp.Body.Error.Code != "" {
+			return &xmlResp.Body, resp, err
+		}
+		return nil, resp, err
+	}
+
+	return &xmlResp.Body, resp, nil
+}
+
+// post sends a soap envelope and returns the exchange, without Info
+// an envelope answered with 200, or with a 500 fault, is decoded into v as it is read,
+// at most MaxResponseSize bytes of the body are read
+func (c *Client) post(url, contentType, body string, v interface{}) (*Response, error) {
+
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Connection", "keep-alive")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	req.Header = header
+
+	r := &Response{Request: redactCredentials(body), Time: time.Now()}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	r.StatusCode, r.Header = resp.StatusCode, resp.Header
+	ct := resp.Header.Get("Content-Type")
+
+	// keep what is read as the raw response
+	var raw bytes.Buffer
+	br := &boundedReader{r: resp.Body, n: c.maxResponseSize()}
+	tee := io.TeeReader(br, &raw)
+
+	switch {
+	case resp.StatusCode == http.StatusOK && !isXMLContentType(ct):
+		// e.g. an html page of a load balancer, rejected unread
+		err = &ParseError{Err: ErrNotSOAP, ContentType: ct, Detail: "content type " + ct}
+	case resp.StatusCode == http.StatusOK, resp.StatusCode == http.StatusInternalServerError && isXMLContentType(ct):
+		err = decodeSOAP(tee, contentCharset(ct), v)
+		if pe, ok := err.(*ParseError); ok {
+			pe.ContentType = ct
+		}
+		if err == nil {
+			_, err = io.Copy(ioutil.Discard, tee)
+		}
+	default:
+		// an error page, the status is the error, so what doesn't fit the limit is left unread
+		io.Copy(&raw, io.LimitReader(resp.Body, c.maxResponseSize()))
+	}
+
+	r.Raw = raw.Bytes()
+	r.Duration = time.Since(r.Time)
+	if err == ErrResponseTooLarge {
+		err = &ParseError{Err: ErrResponseTooLarge, ContentType: ct}
+	}
+
+	// the status is the cause, a body that can't be read only tells more
+	if err != nil && resp.StatusCode != http.StatusOK {
+		err = statusError(resp.StatusCode, err)
+	}
+
+	return r, err
+}
+
+// statusError is the error of a response that isn't 200, with the error reading its body if any
+func statusError(status int, detail error) error {
+	if detail != nil {
+		return fmt.Errorf("HTTP Status: %d, error: %d %s: %w", status, status, http.StatusText(status), detail)
+	}
+	return fmt.Errorf("HTTP Status: %d, error: %d %s", status, status, http.StatusText(status))
+}
+
+// observe records the outcome of a call in client metrics
+func (c *Client) observe(operation string, start time.Time, b *XMLBody, err error) {
+
+	if c.Metrics == nil {
+		return
+	}
+
+	outcome, code := OutcomeOK, ""
+	switch {
+	case b != nil && b.Error != nil && b.Error.Code != "":
+		outcome, code = OutcomeFault, b.Error.Code
+	case err != nil:
+		outcome = OutcomeError
+	case b.VATInfo.Error != nil && b.VATInfo.Error.Code != "":
+		outcome, code = OutcomeRejected, b.VATInfo.Error.Code
+	}
+
+	c.Metrics.ObserveCall(operation, outcome, code, time.Since(start))
+}
@@ -0,0 +1,175 @@
+package rgwspublic
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// a mock response of the service for a vat info call
+const testVATInfoResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+	<env:Header/>
+	<env:Body>
+		<srvc:rgWsPublic2AfmMethodResponse xmlns:srvc="http://rgwspublic2/RgWsPublic2Service" xmlns="http://rgwspublic2/RgWsPublic2">
+			<srvc:result>
+				<rg_ws_public2_result_rtType>
+					<call_seq_id>46447592</call_seq_id>
+					<error_rec>
+						<error_code xsi:nil="true"/>
+						<error_descr xsi:nil="true"/>
+					</error_rec>
+					<afm_called_by_rec>
+						<token_username>USERNAME1</token_username>
+						<token_afm>123456783</token_afm>
+						<token_afm_fullname>ΠΑΠΑΔΟΠΟΥΛΟΣ ΓΕΩΡΓΙΟΣ</token_afm_fullname>
+						<afm_called_by>123456783</afm_called_by>
+						<afm_called_by_fullname>ΠΑΠΑΔΟΠΟΥΛΟΣ ΓΕΩΡΓΙΟΣ</afm_called_by_fullname>
+						<as_on_date>2021-11-22+02:00</as_on_date>
+					</afm_called_by_rec>
+					<basic_rec>
+						<afm>094014298</afm>
+						<doy>1159</doy>
+						<doy_descr>ΦΑΕ ΑΘΗΝΩΝ</doy_descr>
+						<i_ni_flag_descr>ΜΗ ΦΠ</i_ni_flag_descr>
+						<deactivation_flag>1</deactivation_flag>
+						<deactivation_flag_descr>ΕΝΕΡΓΟΣ ΑΦΜ</deactivation_flag_descr>
+						<firm_flag_descr>ΕΠΙΤΗΔΕΥΜΑΤΙΑΣ</firm_flag_descr>
+						<onomasia>ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ</onomasia>
+						<commer_title>ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ Α.Ε.</commer_title>
+						<legal_status_descr>ΑΕ</legal_status_descr>
+						<postal_address>ΑΜΕΡΙΚΗΣ</postal_address>
+						<postal_address_no>4</postal_address_no>
+						<postal_zip_code>10564</postal_zip_code>
+						<postal_area_description>ΑΘΗΝΑ</postal_area_description>
+						<regist_date>1916-01-01+01:34</regist_date>
+						<stop_date xsi:nil="true"/>
+						<normal_vat_system_flag>Y</normal_vat_system_flag>
+					</basic_rec>
+					<firm_act_tab>
+						<item>
+							<firm_act_code>64191204</firm_act_code>
+							<firm_act_descr>ΥΠΗΡΕΣΙΕΣ ΤΡΑΠΕΖΩΝ</firm_act_descr>
+							<firm_act_kind>1</firm_act_kind>
+							<firm_act_kind_descr>ΚΥΡΙΑ</firm_act_kind_descr>
+						</item>
+						<item>
+							<firm_act_code>66191000</firm_act_code>
+							<firm_act_descr>ΥΠΗΡΕΣΙΕΣ ΜΕΣΙΤΩΝ ΧΡΗΜΑΤΙΣΤΗΡΙΟΥ</firm_act_descr>
+							<firm_act_kind>2</firm_act_kind>
+							<firm_act_kind_descr>ΔΕΥΤΕΡΕΥΟΥΣΑ</firm_act_kind_descr>
+						</item>
+					</firm_act_tab>
+				</rg_ws_public2_result_rtType>
+			</srvc:result>
+		</srvc:rgWsPublic2AfmMethodResponse>
+	</env:Body>
+</env:Envelope>`
+
+// testErrorResponse returns a mock vat info response carrying a service error code
+func testErrorResponse(code string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+	<env:Body>
+		<srvc:rgWsPublic2AfmMethodResponse xmlns:srvc="http://rgwspublic2/RgWsPublic2Service" xmlns="http://rgwspublic2/RgWsPublic2">
+			<srvc:result>
+				<rg_ws_public2_result_rtType>
+					<call_seq_id>46447593</call_seq_id>
+					<error_rec>
+						<error_code>%s</error_code>
+						<error_descr>service error %s</error_descr>
+					</error_rec>
+				</rg_ws_public2_result_rtType>
+			</srvc:result>
+		</srvc:rgWsPublic2AfmMethodResponse>
+	</env:Body>
+</env:Envelope>`, code, code)
+}
+
+// a mock response of the service for a version call
+const testVersionResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+	<env:Header/>
+	<env:Body>
+		<srvc:rgWsPublic2VersionInfoResponse xmlns:srvc="http://rgwspublic2/RgWsPublic2Service">
+			<srvc:result>Version: 4.0.1, 22/11/2021</srvc:result>
+		</srvc:rgWsPublic2VersionInfoResponse>
+	</env:Body>
+</env:Envelope>`
+
+// newTestClient starts a local stand-in for the service and returns a client using it
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return &Client{HTTPClient: srv.Client(), Endpoint: srv.URL}
+}
+
+// respond replies with a soap body
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestClientGetVATInfo(t *testing.T) {
+
+	c := newTestClient(t, respond(testVATInfoResponse))
+
+	i, err := c.GetVATInfo("", "094014298", "username", "password")
+	if err != nil {
+		t.Fatalf("error getting VAT info: %s", err)
+	}
+
+	if i.Result.AFM != "094014298" {
+		t.Errorf("unexpected afm, got: %s", i.Result.AFM)
+	}
+	if len(i.Activities) != 2 {
+		t.Errorf("unexpected activities, got: %d, wanted: 2", len(i.Activities))
+	}
+}
+
+func TestClientVersion(t *testing.T) {
+
+	c := newTestClient(t, respond(testVersionResponse))
+
+	v, err := c.Version()
+	if err != nil {
+		t.Fatalf("error getting version: %s", err)
+	}
+
+	if *v != "Version: 4.0.1, 22/11/2021" {
+		t.Errorf("unexpected version, got: %s", *v)
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+
+	code := "RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED"
+	fail := false
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			respond(testErrorResponse(code))(w, r)
+			return
+		}
+		respond(testVATInfoResponse)(w, r)
+	})
+	c.Metrics = NewMetrics()
+
+	if _, err := c.GetVATInfo("", "094014298", "username", "password"); err != nil {
+		t.Fatalf("error getting VAT info: %s", err)
+	}
+
+	fail = true
+	if _, err := c.GetVATInfo("", "094014298", "username", "password"); err == nil {
+		t.Fatalf("expected error for %s", code)
+	}
+
+	if n := c.Metrics.Calls(OpGetVATInfo, OutcomeOK, ""); n != 1 {
+		t.Errorf("unexpected ok calls, got: %d, wanted: 1", n)
+	}
+	if n := c.Metrics.Calls(OpGetVATInfo, OutcomeRejected, code); n != 1 {
+		t.Errorf("unexpected rejected calls, got: %d, wanted: 1", n)
+	}
+}
@@ -0,0 +1,91 @@
+// auditverify checks an audit log written by rgwspublic.AuditLog
+//
+//	auditverify -key key.bin [-head seq:hash] [-repair] audit.jsonl
+//
+// it prints the number of entries and the hash of the last one,
+// and exits with 1 if the log fails verification, 2 on other errors
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kamilakis/rgwspublic"
+)
+
+func main() {
+
+	keyFile := flag.String("key", "", "file holding the HMAC key of the log")
+	head := flag.String("head", "", "seq:hash of the last entry as kept elsewhere, to detect entries cut from the end")
+	repair := flag.Bool("repair", false, "fix a last line left incomplete by a crash before verifying")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -key file [-head seq:hash] [-repair] audit.jsonl\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *keyFile == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	key, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		fail(err)
+	}
+
+	if *repair {
+		changed, err := rgwspublic.RepairAuditLog(path, key)
+		if err != nil {
+			fail(err)
+		}
+		if changed {
+			fmt.Println("repaired an incomplete last line")
+		}
+	}
+
+	n, last, err := verify(path, key, *head)
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("ok: %d entries, head %s\n", n, last)
+}
+
+// verify checks the log at path, and that it still holds the head kept as seq:hash if given
+// a log may have grown since, the entry at seq must have the kept hash
+func verify(path string, key []byte, head string) (int64, string, error) {
+
+	if head == "" {
+		return rgwspublic.VerifyAuditFile(path, key)
+	}
+
+	parts := strings.SplitN(head, ":", 2)
+	seq, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 || seq < 0 {
+		return 0, "", fmt.Errorf("invalid head %q, expected seq:hash", head)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	return rgwspublic.VerifyAuditHead(f, key, seq, parts[1])
+}
+
+func fail(err error) {
+
+	fmt.Fprintln(os.Stderr, err)
+	if errors.Is(err, rgwspublic.ErrAuditTampered) {
+		os.Exit(1)
+	}
+	os.Exit(2)
+}
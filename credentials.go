@@ -0,0 +1,298 @@
+package rgwspublic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoCredentials   = errors.New("no credentials provider configured")
+	ErrWrongPassphrase = errors.New("credentials file cannot be decrypted, wrong passphrase or corrupted file")
+)
+
+// default environment variables read by EnvCredentials
+const (
+	EnvUsername = "GSISUsername"
+	EnvPassword = "GSISPassword"
+)
+
+// kdfIterations of pbkdf2 used when encrypting a credentials file
+const kdfIterations = 600000
+
+// maxKDFIterations bounds the iterations read from a credentials file,
+// so a tampered file cannot stall decryption
+const maxKDFIterations = 10 * kdfIterations
+
+// Credentials are the special access codes of the service
+// as issued by https://www1.aade.gr/sgsisapps/tokenservices/protected/displayConsole.htm
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Validate checks credentials are acceptable by the service
+func (c Credentials) Validate() error {
+
+	if len(c.Username) < 6 || len(c.Password) < 6 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// CredentialsProvider returns the credentials to use for a call
+// it is asked on every call, so rotated credentials take effect immediately
+type CredentialsProvider interface {
+	Credentials() (Credentials, error)
+}
+
+// StaticCredentials is a provider of fixed credentials
+type StaticCredentials Credentials
+
+// Credentials returns the fixed credentials, if valid
+func (s StaticCredentials) Credentials() (Credentials, error) {
+	c := Credentials(s)
+	return c, c.Validate()
+}
+
+// EnvCredentials reads credentials from environment variables
+// EnvUsername and EnvPassword are used for empty variable names
+type EnvCredentials struct {
+	UsernameVar string
+	PasswordVar string
+}
+
+// Credentials returns the current values of the environment variables
+func (e EnvCredentials) Credentials() (Credentials, error) {
+
+	user, pass := e.UsernameVar, e.PasswordVar
+	if user == "" {
+		user = EnvUsername
+	}
+	if pass == "" {
+		pass = EnvPassword
+	}
+
+	c := Credentials{Username: os.Getenv(user), Password: os.Getenv(pass)}
+	return c, c.Validate()
+}
+
+// FileCredentials reads credentials from a json file
+// e.g. {"username": "...", "password": "..."}
+// the file is read again whenever it changes
+type FileCredentials struct {
+	watched watchedFile
+}
+
+// NewFileCredentials returns a provider reading the json file at path
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{watched: watchedFile{path: path}}
+}
+
+// Credentials returns the credentials in the file
+func (f *FileCredentials) Credentials() (Credentials, error) {
+	return f.watched.load(func(b []byte) (Credentials, error) {
+		c := Credentials{}
+		err := json.Unmarshal(b, &c)
+		return c, err
+	})
+}
+
+// EncryptedFileCredentials reads credentials from a file encrypted
+// with a passphrase, as written by WriteEncryptedCredentials
+// the file is read again whenever it changes
+type EncryptedFileCredentials struct {
+	watched    watchedFile
+	passphrase string
+}
+
+// NewEncryptedFileCredentials returns a provider decrypting the file at path
+func NewEncryptedFileCredentials(path, passphrase string) *EncryptedFileCredentials {
+	return &EncryptedFileCredentials{watched: watchedFile{path: path}, passphrase: passphrase}
+}
+
+// Credentials returns the decrypted credentials in the file
+func (f *EncryptedFileCredentials) Credentials() (Credentials, error) {
+	return f.watched.load(func(b []byte) (Credentials, error) {
+		return DecryptCredentials(b, f.passphrase)
+	})
+}
+
+// watchedFile caches credentials read from a file until it is modified
+type watchedFile struct {
+	path string
+
+	mu    sync.Mutex
+	mod   time.Time
+	size  int64
+	creds Credentials
+	err   error
+}
+
+func (w *watchedFile) load(decode func([]byte) (Credentials, error)) (Credentials, error) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if !fi.ModTime().Equal(w.mod) || fi.Size() != w.size {
+
+		b, err := ioutil.ReadFile(w.path)
+		if err != nil {
+			return Credentials{}, err
+		}
+
+		w.creds, w.err = decode(b)
+		if w.err == nil {
+			w.err = w.creds.Validate()
+		}
+		w.mod, w.size = fi.ModTime(), fi.Size()
+	}
+
+	return w.creds, w.err
+}
+
+// encryptedCredentials is the content of an encrypted credentials file
+type encryptedCredentials struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// EncryptCredentials encrypts credentials with a passphrase using AES-256-GCM
+// the key is derived with PBKDF2-HMAC-SHA256
+func EncryptCredentials(c Credentials, passphrase string) ([]byte, error) {
+
+	plain, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	e := encryptedCredentials{
+		KDF:        "pbkdf2-sha256",
+		Iterations: kdfIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, e.Salt, e.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Data = gcm.Seal(nil, e.Nonce, plain, nil)
+
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// DecryptCredentials decrypts the output of EncryptCredentials
+func DecryptCredentials(b []byte, passphrase string) (Credentials, error) {
+
+	e := encryptedCredentials{}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return Credentials{}, err
+	}
+
+	if e.KDF != "pbkdf2-sha256" {
+		return Credentials{}, fmt.Errorf("unsupported key derivation: %q", e.KDF)
+	}
+
+	gcm, err := newGCM(passphrase, e.Salt, e.Iterations)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if len(e.Nonce) != gcm.NonceSize() {
+		return Credentials{}, ErrWrongPassphrase
+	}
+
+	plain, err := gcm.Open(nil, e.Nonce, e.Data, nil)
+	if err != nil {
+		return Credentials{}, ErrWrongPassphrase
+	}
+
+	c := Credentials{}
+	err = json.Unmarshal(plain, &c)
+	return c, err
+}
+
+// WriteEncryptedCredentials encrypts credentials into a file readable only by its owner
+func WriteEncryptedCredentials(path string, c Credentials, passphrase string) error {
+
+	b, err := EncryptCredentials(c, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+
+	if iterations < 1 || iterations > maxKDFIterations {
+		return nil, fmt.Errorf("invalid key derivation iterations: %d", iterations)
+	}
+
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key as specified in RFC 8018
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+
+	prf := hmac.New(sha256.New, password)
+	size := prf.Size()
+
+	var key []byte
+	u := make([]byte, size)
+	for block := uint32(1); len(key) < keyLen; block++ {
+
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], block)
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(n[:])
+		key = prf.Sum(key)
+		t := key[len(key)-size:]
+		copy(u, t)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+
+	return key[:keyLen]
+}
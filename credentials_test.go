@@ -0,0 +1,146 @@
+package rgwspublic
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticCredentials(t *testing.T) {
+
+	if _, err := (StaticCredentials{Username: "user", Password: "password"}).Credentials(); err != ErrInvalidCredentials {
+		t.Errorf("expected invalid credentials, got: %v", err)
+	}
+
+	c, err := StaticCredentials{Username: "username", Password: "password"}.Credentials()
+	if err != nil || c.Username != "username" {
+		t.Errorf("unexpected credentials: %v, error: %v", c, err)
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+
+	t.Setenv("TEST_GSIS_USER", "envuser1")
+	t.Setenv("TEST_GSIS_PASS", "envpass1")
+
+	c, err := EnvCredentials{UsernameVar: "TEST_GSIS_USER", PasswordVar: "TEST_GSIS_PASS"}.Credentials()
+	if err != nil {
+		t.Fatalf("error reading env credentials: %s", err)
+	}
+	if c.Username != "envuser1" || c.Password != "envpass1" {
+		t.Errorf("unexpected credentials: %v", c)
+	}
+}
+
+// touch writes a file and moves its modification time forward,
+// so a rewrite within the filesystem time resolution is noticed
+func touch(t *testing.T, path string, b []byte, age time.Duration) {
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(age)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileCredentialsRotation(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	touch(t, path, []byte(`{"username": "firstuser", "password": "firstpass"}`), -time.Hour)
+
+	p := NewFileCredentials(path)
+	c, err := p.Credentials()
+	if err != nil || c.Username != "firstuser" {
+		t.Fatalf("unexpected credentials: %v, error: %v", c, err)
+	}
+
+	touch(t, path, []byte(`{"username": "rotateduser", "password": "rotatedpass"}`), 0)
+	c, err = p.Credentials()
+	if err != nil || c.Username != "rotateduser" {
+		t.Fatalf("rotated credentials not loaded: %v, error: %v", c, err)
+	}
+
+	touch(t, path, []byte(`{"username": "short", "password": "rotatedpass"}`), time.Hour)
+	if _, err = p.Credentials(); err != ErrInvalidCredentials {
+		t.Errorf("expected invalid credentials, got: %v", err)
+	}
+}
+
+func TestEncryptedFileCredentials(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	err := WriteEncryptedCredentials(path, Credentials{Username: "secretuser", Password: "secretpass"}, "correct horse")
+	if err != nil {
+		t.Fatalf("error writing encrypted credentials: %s", err)
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(b), "secretpass") {
+		t.Fatalf("password stored in clear text")
+	}
+
+	c, err := NewEncryptedFileCredentials(path, "correct horse").Credentials()
+	if err != nil || c.Password != "secretpass" {
+		t.Fatalf("unexpected credentials: %v, error: %v", c, err)
+	}
+
+	if _, err := NewEncryptedFileCredentials(path, "wrong horse").Credentials(); err != ErrWrongPassphrase {
+		t.Errorf("expected wrong passphrase error, got: %v", err)
+	}
+}
+
+func TestDecryptCredentialsIterations(t *testing.T) {
+
+	b, err := EncryptCredentials(Credentials{Username: "username", Password: "password"}, "passphrase")
+	if err != nil {
+		t.Fatalf("error encrypting credentials: %s", err)
+	}
+
+	for _, n := range []string{"0", "-1", "1000000000"} {
+		tampered := strings.Replace(string(b), `"iterations": 600000`, `"iterations": `+n, 1)
+		if _, err := DecryptCredentials([]byte(tampered), "passphrase"); err == nil {
+			t.Errorf("iterations %s accepted", n)
+		}
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+
+	// test vector from RFC 7914, section 11
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	wanted := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(key) != wanted {
+		t.Errorf("unexpected key: %x", key)
+	}
+}
+
+func TestClientLookup(t *testing.T) {
+
+	var user string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(b), "<ns1:Username>provided</ns1:Username>") {
+			user = "provided"
+		}
+		respond(testVATInfoResponse)(w, r)
+	})
+
+	if _, err := c.Lookup("", "094014298"); err != ErrNoCredentials {
+		t.Errorf("expected no credentials error, got: %v", err)
+	}
+
+	c.Credentials = StaticCredentials{Username: "provided", Password: "password"}
+	if _, err := c.Lookup("", "094014298"); err != nil {
+		t.Fatalf("error looking up VAT info: %s", err)
+	}
+	if user != "provided" {
+		t.Errorf("credentials of provider not sent")
+	}
+}
@@ -0,0 +1,376 @@
+package rgwspublic
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ActivityLayout is how activities are flattened in csv
+type ActivityLayout int
+
+const (
+	ActivitiesMain   ActivityLayout = iota // columns of the main (ΚΥΡΙΑ) activity
+	ActivitiesJoined                       // one column, activities joined with "; ", a ';' or backslash in a description escaped with a backslash
+	ActivitiesRows                         // one row per activity
+)
+
+// activity columns of each layout
+var (
+	mainActivityColumns = []string{"main_activity_code", "main_activity_description"}
+	joinedColumns       = []string{"activities"}
+	activityRowColumns  = []string{"activity_code", "activity_kind", "activity_kind_description", "activity_description"}
+)
+
+// activity kind descriptions, by kind
+var activityKinds = map[int]string{
+	1: "ΚΥΡΙΑ",
+	2: "ΔΕΥΤΕΡΕΥΟΥΣΑ",
+	3: "ΛΟΙΠΗ",
+	4: "ΒΟΗΘΗΤΙΚΗ",
+}
+
+const utf8BOM = "\ufeff"
+
+// ErrCSVNoAFM is returned for one row per activity without an afm column to group the rows by
+var ErrCSVNoAFM = errors.New("csv with one row per activity needs an afm column")
+
+// escaping of the separator in joined activities
+var (
+	activityEscaper   = strings.NewReplacer(`\`, `\\`, `;`, `\;`)
+	activityUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, `;`)
+)
+
+// CSVOptions configure WriteCSV
+type CSVOptions struct {
+	// Columns of VATResult by json name, all in declaration order if empty
+	Columns []string
+
+	// Activities layout, main activity columns by default
+	Activities ActivityLayout
+
+	// Comma is the delimiter, ',' if zero, Greek Excel expects ';'
+	Comma rune
+
+	// BOM starts the output with a UTF-8 byte order mark, so Excel detects the encoding
+	BOM bool
+}
+
+// CSVColumns returns the json names of VATResult, the columns of a csv by default
+func CSVColumns() []string {
+
+	t := reflect.TypeOf(VATResult{})
+	cols := make([]string, t.NumField())
+	for i := range cols {
+		cols[i] = jsonName(t.Field(i))
+	}
+
+	return cols
+}
+
+// resultFields maps json names of VATResult to field indexes
+func resultFields() map[string]int {
+
+	fields := map[string]int{}
+	for i, name := range CSVColumns() {
+		fields[name] = i
+	}
+
+	return fields
+}
+
+// WriteCSV writes records as csv with a header
+// values are written as returned, trimmed, so an export is a record of the responses,
+// compare them with NormalizeGreek
+func WriteCSV(w io.Writer, infos []*VATInfo, opts CSVOptions) error {
+
+	cols := opts.Columns
+	if len(cols) == 0 {
+		cols = CSVColumns()
+	}
+
+	fields := resultFields()
+	idx := make([]int, len(cols))
+	for i, c := range cols {
+		f, ok := fields[c]
+		if !ok {
+			return fmt.Errorf("unknown csv column: %q", c)
+		}
+		idx[i] = f
+	}
+
+	if opts.Activities == ActivitiesRows && !hasColumn(cols, "afm") {
+		return ErrCSVNoAFM
+	}
+
+	header := append([]string{}, cols...)
+	switch opts.Activities {
+	case ActivitiesMain:
+		header = append(header, mainActivityColumns...)
+	case ActivitiesJoined:
+		header = append(header, joinedColumns...)
+	case ActivitiesRows:
+		header = append(header, activityRowColumns...)
+	default:
+		return fmt.Errorf("unknown activity layout: %d", opts.Activities)
+	}
+
+	if opts.BOM {
+		if _, err := io.WriteString(w, utf8BOM); err != nil {
+			return err
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+
+		rv := reflect.ValueOf(info.Result)
+		row := make([]string, len(idx))
+		for i, f := range idx {
+			row[i] = strings.TrimSpace(rv.Field(f).String())
+		}
+
+		switch opts.Activities {
+		case ActivitiesMain:
+			code, descr := "", ""
+			for _, a := range info.Activities {
+				if a.Kind == 1 {
+					code, descr = strconv.Itoa(a.Code), squash(a.Descriptionn)
+					break
+				}
+			}
+			if err := cw.Write(append(row, code, descr)); err != nil {
+				return err
+			}
+
+		case ActivitiesJoined:
+			acts := make([]string, len(info.Activities))
+			for i, a := range info.Activities {
+				acts[i] = fmt.Sprintf("%d:%d:%s", a.Code, a.Kind, activityEscaper.Replace(squash(a.Descriptionn)))
+			}
+			if err := cw.Write(append(row, strings.Join(acts, "; "))); err != nil {
+				return err
+			}
+
+		case ActivitiesRows:
+			if len(info.Activities) == 0 {
+				if err := cw.Write(append(row, "", "", "", "")); err != nil {
+					return err
+				}
+			}
+			for _, a := range info.Activities {
+				r := append(append([]string{}, row...), strconv.Itoa(a.Code), strconv.Itoa(a.Kind), squash(a.KindDescr), squash(a.Descriptionn))
+				if err := cw.Write(r); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV loads records written by WriteCSV
+// the delimiter, any rune WriteCSV accepts, a byte order mark and the activity layout
+// are detected from the header
+// with one row per activity, consecutive rows of the same afm make one record
+func ReadCSV(r io.Reader) ([]*VATInfo, error) {
+
+	br := bufio.NewReader(r)
+
+	// skip a byte order mark
+	if b, err := br.Peek(len(utf8BOM)); err == nil && string(b) == utf8BOM {
+		br.Discard(len(utf8BOM))
+	}
+
+	// the header tells the delimiter
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	comma := headerComma(line)
+
+	cr := csv.NewReader(io.MultiReader(strings.NewReader(line), br))
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := resultFields()
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.TrimSpace(h)] = i
+	}
+
+	// rows of a record are told by their afm
+	_, rows := cols["activity_code"]
+	if _, ok := cols["afm"]; rows && !ok {
+		return nil, ErrCSVNoAFM
+	}
+
+	var infos []*VATInfo
+	for n := 2; ; n++ {
+
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		get := func(col string) string {
+			if i, ok := cols[col]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		info := &VATInfo{}
+		rv := reflect.ValueOf(&info.Result).Elem()
+		for name, f := range fields {
+			rv.Field(f).SetString(get(name))
+		}
+
+		// continuation of the previous record
+		if rows && len(infos) > 0 && infos[len(infos)-1].Result.AFM == info.Result.AFM {
+			info = infos[len(infos)-1]
+		} else {
+			infos = append(infos, info)
+		}
+
+		var acts []FirmActivity
+		switch {
+		case rows:
+			if get("activity_code") != "" {
+				a, err := parseActivity(get("activity_code"), get("activity_kind"), get("activity_description"))
+				if err != nil {
+					return nil, fmt.Errorf("csv record %d: %s", n, err)
+				}
+				if d := get("activity_kind_description"); d != "" {
+					a.KindDescr = d
+				}
+				acts = append(acts, a)
+			}
+
+		case get("activities") != "":
+			for _, s := range splitActivities(get("activities")) {
+				parts := strings.SplitN(strings.TrimSpace(s), ":", 3)
+				if len(parts) != 3 {
+					return nil, fmt.Errorf("csv record %d: invalid activity %q", n, s)
+				}
+				a, err := parseActivity(parts[0], parts[1], activityUnescaper.Replace(parts[2]))
+				if err != nil {
+					return nil, fmt.Errorf("csv record %d: %s", n, err)
+				}
+				acts = append(acts, a)
+			}
+
+		case get("main_activity_code") != "":
+			a, err := parseActivity(get("main_activity_code"), "1", get("main_activity_description"))
+			if err != nil {
+				return nil, fmt.Errorf("csv record %d: %s", n, err)
+			}
+			acts = append(acts, a)
+		}
+
+		info.Activities = append(info.Activities, acts...)
+	}
+
+	return infos, nil
+}
+
+// headerComma returns the delimiter following the first column of a header,
+// the longest known column name it starts with, ',' for a single column
+func headerComma(line string) rune {
+
+	line = strings.TrimPrefix(line, `"`)
+
+	names := append(CSVColumns(), mainActivityColumns...)
+	names = append(names, joinedColumns...)
+	names = append(names, activityRowColumns...)
+
+	first := ""
+	for _, name := range names {
+		if strings.HasPrefix(line, name) && len(name) > len(first) {
+			first = name
+		}
+	}
+
+	// an unknown first column, the more frequent of ',' and ';'
+	if first == "" {
+		if strings.Count(line, ";") > strings.Count(line, ",") {
+			return ';'
+		}
+		return ','
+	}
+
+	rest := strings.TrimPrefix(strings.TrimPrefix(line, first), `"`)
+	for _, r := range rest {
+		if r == '\r' || r == '\n' {
+			break
+		}
+		return r
+	}
+
+	return ','
+}
+
+// splitActivities splits joined activities on the separators not escaped
+func splitActivities(s string) []string {
+
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ';':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func hasColumn(cols []string, col string) bool {
+	for _, c := range cols {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+func parseActivity(code, kind, descr string) (FirmActivity, error) {
+
+	c, err := strconv.Atoi(strings.TrimSpace(code))
+	if err != nil {
+		return FirmActivity{}, fmt.Errorf("invalid activity code %q", code)
+	}
+
+	k, err := strconv.Atoi(strings.TrimSpace(kind))
+	if err != nil {
+		return FirmActivity{}, fmt.Errorf("invalid activity kind %q", kind)
+	}
+
+	return FirmActivity{Code: c, Kind: k, KindDescr: activityKinds[k], Descriptionn: strings.TrimSpace(descr)}, nil
+}
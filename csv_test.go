@@ -0,0 +1,131 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+
+	infos := []*VATInfo{
+		testSnapshot(t, testVATInfoResponse),
+		testSnapshot(t, testChangedResponse),
+	}
+	infos[1].Result.AFM = "090165560"
+
+	layouts := map[ActivityLayout]int{ActivitiesMain: 1, ActivitiesJoined: 2, ActivitiesRows: 2}
+	for layout, acts := range layouts {
+
+		var buf bytes.Buffer
+		err := WriteCSV(&buf, infos, CSVOptions{Activities: layout, Comma: ';', BOM: true})
+		if err != nil {
+			t.Fatalf("error writing csv: %s", err)
+		}
+
+		if !strings.HasPrefix(buf.String(), "\ufeffafm;doy;doy_description;") {
+			t.Errorf("unexpected header: %s", strings.SplitN(buf.String(), "\n", 2)[0])
+		}
+
+		read, err := ReadCSV(&buf)
+		if err != nil {
+			t.Fatalf("error reading csv, layout %d: %s", layout, err)
+		}
+		if len(read) != 2 {
+			t.Fatalf("unexpected records, layout %d: %d", layout, len(read))
+		}
+
+		if read[0].Result != infos[0].Result || read[1].Result.AFM != "090165560" {
+			t.Errorf("unexpected result, layout %d: %+v", layout, read[0].Result)
+		}
+		if len(read[0].Activities) != acts {
+			t.Errorf("unexpected activities, layout %d: %+v", layout, read[0].Activities)
+		}
+		if a := read[1].Activities[len(read[1].Activities)-1]; a.Code != 66191000 || a.Kind != 1 {
+			t.Errorf("unexpected main activity, layout %d: %+v", layout, a)
+		}
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+
+	infos := []*VATInfo{testSnapshot(t, testVATInfoResponse)}
+
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, infos, CSVOptions{Columns: []string{"afm", "onomasia"}, Activities: ActivitiesJoined})
+	if err != nil {
+		t.Fatalf("error writing csv: %s", err)
+	}
+
+	wanted := "afm,onomasia,activities\n" +
+		"094014298,ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ,64191204:1:ΥΠΗΡΕΣΙΕΣ ΤΡΑΠΕΖΩΝ; 66191000:2:ΥΠΗΡΕΣΙΕΣ ΜΕΣΙΤΩΝ ΧΡΗΜΑΤΙΣΤΗΡΙΟΥ\n"
+	if buf.String() != wanted {
+		t.Errorf("unexpected csv:\n%s", buf.String())
+	}
+
+	if err := WriteCSV(&buf, infos, CSVOptions{Columns: []string{"name"}}); err == nil {
+		t.Errorf("expected unknown column error")
+	}
+}
+
+func TestCSVDelimiters(t *testing.T) {
+
+	infos := []*VATInfo{testSnapshot(t, testVATInfoResponse)}
+
+	for _, comma := range []rune{'\t', '|', ';', ','} {
+
+		var buf bytes.Buffer
+		if err := WriteCSV(&buf, infos, CSVOptions{Activities: ActivitiesRows, Comma: comma}); err != nil {
+			t.Fatalf("error writing csv: %s", err)
+		}
+
+		read, err := ReadCSV(&buf)
+		if err != nil {
+			t.Fatalf("error reading csv delimited by %q: %s", comma, err)
+		}
+		if len(read) != 1 || read[0].Result != infos[0].Result || len(read[0].Activities) != 2 {
+			t.Errorf("unexpected records delimited by %q: %+v", comma, read)
+		}
+	}
+
+	// a single column
+	read, err := ReadCSV(strings.NewReader("afm\n094014298\n"))
+	if err != nil || len(read) != 1 || read[0].Result.AFM != "094014298" {
+		t.Errorf("unexpected single column records: %+v %v", read, err)
+	}
+}
+
+func TestCSVActivitySeparator(t *testing.T) {
+
+	info := testSnapshot(t, testVATInfoResponse)
+	info.Activities[0].Descriptionn = `ΥΠΗΡΕΣΙΕΣ; ΤΡΑΠΕΖΩΝ \ ΛΟΙΠΕΣ`
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, []*VATInfo{info}, CSVOptions{Activities: ActivitiesJoined}); err != nil {
+		t.Fatalf("error writing csv: %s", err)
+	}
+
+	read, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatalf("error reading csv: %s", err)
+	}
+	if len(read[0].Activities) != 2 || read[0].Activities[0].Descriptionn != info.Activities[0].Descriptionn {
+		t.Errorf("unexpected activities: %+v", read[0].Activities)
+	}
+}
+
+func TestCSVRowsAFM(t *testing.T) {
+
+	infos := []*VATInfo{testSnapshot(t, testVATInfoResponse)}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, infos, CSVOptions{Columns: []string{"onomasia"}, Activities: ActivitiesRows}); err != ErrCSVNoAFM {
+		t.Errorf("expected no afm error writing, got: %v", err)
+	}
+
+	in := "onomasia,activity_code,activity_kind,activity_kind_description,activity_description\n" +
+		"ΤΡΑΠΕΖΑ,64191204,1,ΚΥΡΙΑ,ΥΠΗΡΕΣΙΕΣ ΤΡΑΠΕΖΩΝ\n"
+	if _, err := ReadCSV(strings.NewReader(in)); err != ErrCSVNoAFM {
+		t.Errorf("expected no afm error reading, got: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package rgwspublic
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalXML decodes a response by walking its tokens, the response shape is known
+// so this avoids the reflection of xml.Unmarshal, element names match ignoring namespaces
+func (r *XMLResponse) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+
+	r.XMLName = start.Name
+	b := &r.Body
+
+	// path of the current element, below the envelope
+	path := make([]string, 0, 8)
+	text := make([]byte, 0, 64)
+	record := false
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			path = append(path, tok.Name.Local)
+			text = text[:0]
+
+			switch {
+			case len(path) == 2 && at(path, "Body", "Fault"):
+				b.Error = &ErrorInfo{}
+			case len(path) == 5 && inVATInfo(path) && path[4] == "basic_rec":
+				record = true
+			case len(path) == 5 && inVATInfo(path) && path[4] == "error_rec":
+				b.VATInfo.Error = &ErrorVATInfo{}
+			case len(path) == 6 && inVATInfo(path) && path[4] == "firm_act_tab" && path[5] == "item":
+				b.VATInfo.Activities = append(b.VATInfo.Activities, FirmActivity{})
+			}
+
+		case xml.CharData:
+			text = append(text, tok...)
+
+		case xml.EndElement:
+			if len(path) == 0 {
+				// the end of the envelope
+				if record {
+					b.VATInfo.Normalize()
+				}
+				return nil
+			}
+			if err := b.set(path, text); err != nil {
+				return err
+			}
+			path = path[:len(path)-1]
+		}
+	}
+}
+
+// set assigns the text of the element at path, other elements are ignored
+func (b *XMLBody) set(path []string, text []byte) error {
+
+	switch {
+	case len(path) == 3 && at(path, "Body", "rgWsPublic2VersionInfoResponse", "result"):
+		v := string(text)
+		b.Version = &v
+
+	case len(path) == 4 && b.Error != nil && at(path, "Body", "Fault"):
+		switch {
+		case at(path[2:], "Code", "Value"):
+			b.Error.Code = string(text)
+		case at(path[2:], "Reason", "Text"):
+			b.Error.Message = string(text)
+		}
+
+	case len(path) == 5 && inVATInfo(path) && path[4] == "call_seq_id":
+		return setInt(&b.VATInfo.CallSeqID, text)
+
+	case len(path) == 6 && inVATInfo(path):
+		i := &b.VATInfo
+		switch path[4] {
+		case "afm_called_by_rec":
+			i.CalledBy.set(path[5], string(text))
+		case "basic_rec":
+			i.Result.set(path[5], string(text))
+		case "error_rec":
+			if i.Error != nil {
+				i.Error.set(path[5], string(text))
+			}
+		}
+
+	case len(path) == 7 && inVATInfo(path) && path[4] == "firm_act_tab" && path[5] == "item":
+		if n := len(b.VATInfo.Activities); n > 0 {
+			return b.VATInfo.Activities[n-1].set(path[6], text)
+		}
+	}
+
+	return nil
+}
+
+func (v *VATCalledBy) set(name, s string) {
+	switch name {
+	case "token_username":
+		v.TokenUsername = s
+	case "token_afm":
+		v.TokenAFM = s
+	case "token_afm_fullname":
+		v.TokenAFMFullName = s
+	case "afm_called_by":
+		v.AFMCalledBy = s
+	case "afm_called_by_fullname":
+		v.AFMCalledByFullName = s
+	case "as_on_date":
+		v.AsOnDate = s
+	}
+}
+
+func (r *VATResult) set(name, s string) {
+	switch name {
+	case "afm":
+		r.AFM = s
+	case "doy":
+		r.DOY = s
+	case "doy_descr":
+		r.DOYDescription = s
+	case "i_ni_flag_descr":
+		r.InitialFlagDescription = s
+	case "deactivation_flag":
+		r.DeactivationFlag = s
+	case "deactivation_flag_desc":
+		r.DeactivationFlagDescription = s
+	case "firm_flag_descr":
+		r.FirmFlagDescription = s
+	case "onomasia":
+		r.Onomasia = s
+	case "commer_title":
+		r.CommercialTitle = s
+	case "legal_status_descr":
+		r.LegalStatusDescription = s
+	case "postal_address":
+		r.PostalAddress = s
+	case "postal_address_no":
+		r.PostalAddressNo = s
+	case "postal_zip_code":
+		r.PostalZipCode = s
+	case "postal_area_description":
+		r.PostalAreaDescription = s
+	case "regist_date":
+		r.RegistrationDate = s
+	case "stop_date":
+		r.StopDate = s
+	case "normal_vat_system_flag":
+		r.NormalVATSystemFlag = s
+	}
+}
+
+func (e *ErrorVATInfo) set(name, s string) {
+	switch name {
+	case "error_code":
+		e.Code = s
+	case "error_descr":
+		e.Message = s
+	}
+}
+
+func (a *FirmActivity) set(name string, text []byte) error {
+	switch name {
+	case "firm_act_code":
+		return setInt(&a.Code, text)
+	case "firm_act_descr":
+		a.Descriptionn = string(text)
+	case "firm_act_kind":
+		return setInt(&a.Kind, text)
+	case "firm_act_kind_descr":
+		a.KindDescr = string(text)
+	}
+	return nil
+}
+
+// setInt parses an integer element like xml.Unmarshal, an empty one is zero
+func setInt(v *int, text []byte) error {
+
+	if len(text) == 0 {
+		*v = 0
+		return nil
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(string(text)), 10, 0)
+	if err != nil {
+		return err
+	}
+
+	*v = int(n)
+	return nil
+}
+
+// at reports whether path starts with names
+func at(path []string, names ...string) bool {
+
+	if len(path) < len(names) {
+		return false
+	}
+	for i, n := range names {
+		if path[i] != n {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inVATInfo reports whether path is within the vat info record
+func inVATInfo(path []string) bool {
+	return at(path, "Body", "rgWsPublic2AfmMethodResponse", "result", "rg_ws_public2_result_rtType")
+}
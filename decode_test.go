@@ -0,0 +1,127 @@
+package rgwspublic
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reflectResponse has the tags of XMLResponse without its decoder
+type reflectResponse XMLResponse
+
+const testFaultResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+	<env:Body>
+		<env:Fault>
+			<env:Code><env:Value>env:Receiver</env:Value></env:Code>
+			<env:Reason><env:Text xml:lang="en">Internal Error</env:Text></env:Reason>
+		</env:Fault>
+	</env:Body>
+</env:Envelope>`
+
+func TestDecodeMatchesUnmarshal(t *testing.T) {
+
+	bodies := map[string]string{
+		"info":      testVATInfoResponse,
+		"error":     testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF"),
+		"version":   testVersionResponse,
+		"fault":     testFaultResponse,
+		"delegated": testDelegatedResponse,
+		"changed":   testChangedResponse,
+	}
+
+	for name, body := range bodies {
+		var got XMLResponse
+		if err := xml.Unmarshal([]byte(body), &got); err != nil {
+			t.Errorf("%s: error decoding: %s", name, err)
+			continue
+		}
+
+		var want reflectResponse
+		if err := xml.Unmarshal([]byte(body), &want); err != nil {
+			t.Fatalf("%s: error unmarshaling: %s", name, err)
+		}
+
+		// the normalized form is only set by the decoder
+		if got.Body.VATInfo.Normalized != nil {
+			want.Body.VATInfo.Normalize()
+		}
+
+		if !reflect.DeepEqual(got, XMLResponse(want)) {
+			t.Errorf("%s: decoded differently\n got: %+v\nwant: %+v", name, got.Body, want.Body)
+		}
+	}
+}
+
+func TestDecodeBadInt(t *testing.T) {
+
+	body := strings.Replace(testVATInfoResponse, "<call_seq_id>46447592", "<call_seq_id>4644x592", 1)
+	var r XMLResponse
+	if err := xml.Unmarshal([]byte(body), &r); err == nil {
+		t.Errorf("expected an error for a bad call_seq_id")
+	}
+}
+
+func TestDecodeAllocs(t *testing.T) {
+
+	b := []byte(testVATInfoResponse)
+	tokens := testing.AllocsPerRun(50, func() {
+		var r XMLResponse
+		xml.Unmarshal(b, &r)
+	})
+	reflection := testing.AllocsPerRun(50, func() {
+		var r reflectResponse
+		xml.Unmarshal(b, &r)
+	})
+
+	if tokens >= reflection {
+		t.Errorf("token decoding allocates %.0f times, reflection %.0f", tokens, reflection)
+	}
+}
+
+func TestStringAllocs(t *testing.T) {
+
+	i := testSnapshot(t, testVATInfoResponse)
+	if n := testing.AllocsPerRun(50, func() { _ = i.String() }); n > 1 {
+		t.Errorf("String allocates %.0f times", n)
+	}
+}
+
+func BenchmarkDecodeXML(b *testing.B) {
+
+	body := []byte(testVATInfoResponse)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeXML(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeXMLReflect(b *testing.B) {
+
+	body := []byte(testVATInfoResponse)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		var r reflectResponse
+		if err := xml.Unmarshal(body, &r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVATInfoString(b *testing.B) {
+
+	r := XMLResponse{}
+	if err := xml.Unmarshal([]byte(testVATInfoResponse), &r); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = r.Body.VATInfo.String()
+	}
+}
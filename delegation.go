@@ -0,0 +1,89 @@
+package rgwspublic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrCalledByNotFound   = errors.New("called by AFM not found in the TAXIS registry")
+	ErrNotAuthorized      = errors.New("credentials are not authorized by the called by AFM")
+	ErrDelegationMismatch = errors.New("service acted on behalf of another AFM than requested")
+	ErrNoIdentity         = errors.New("service did not return the identity of the caller")
+)
+
+// DelegationError is returned when a call on behalf of another AFM fails
+// it unwraps to ErrCalledByNotFound, ErrNotAuthorized or ErrDelegationMismatch
+type DelegationError struct {
+	OnBehalfOf string        // AFM the call was made for
+	Identity   VATCalledBy   // as echoed by the service
+	Err        error         // reason
+	Cause      *ServiceError // service error, if any
+}
+
+func (e *DelegationError) Error() string {
+	return fmt.Sprintf("acting on behalf of %s: %s", e.OnBehalfOf, e.Err)
+}
+
+func (e *DelegationError) Unwrap() error {
+	return e.Err
+}
+
+// checkDelegation maps delegation service errors and checks the echoed identity
+func checkDelegation(calledby string, info *VATInfo) error {
+
+	err := info.error()
+
+	if se, ok := err.(*ServiceError); ok {
+		de := &DelegationError{OnBehalfOf: calledby, Identity: info.CalledBy, Cause: se}
+		switch se.Code {
+		case "RG_WS_PUBLIC_AFM_CALLED_BY_NOT_FOUND":
+			de.Err = ErrCalledByNotFound
+			return de
+		case "RG_WS_PUBLIC_TOKEN_AFM_NOT_AUTHORIZED":
+			de.Err = ErrNotAuthorized
+			return de
+		}
+	}
+
+	if err != nil || calledby == "" {
+		return err
+	}
+
+	if strings.TrimSpace(info.CalledBy.AFMCalledBy) != calledby {
+		return &DelegationError{OnBehalfOf: calledby, Identity: info.CalledBy, Err: ErrDelegationMismatch}
+	}
+
+	return nil
+}
+
+// WhoAmI reports the identity behind the credentials of the client
+// and the AFM they act for, as the service sees them
+// it looks up calledfor, e.g. your own AFM, and counts against the quota
+// service errors about calledfor itself are ignored
+func (c *Client) WhoAmI(calledfor string) (*VATCalledBy, error) {
+
+	if c.Credentials == nil {
+		return nil, c.onError(ErrNoCredentials)
+	}
+
+	info, err := c.getVATInfo("", calledfor, c.Credentials, lookupOptions{purpose: "whoami"})
+	if info == nil {
+		return nil, err
+	}
+
+	var de *DelegationError
+	if errors.As(err, &de) {
+		return nil, err
+	}
+
+	if info.CalledBy.TokenUsername == "" && info.CalledBy.TokenAFM == "" {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNoIdentity
+	}
+
+	return &info.CalledBy, nil
+}
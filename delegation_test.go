@@ -0,0 +1,96 @@
+package rgwspublic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// a mock response of a call on behalf of 987654324
+var testDelegatedResponse = strings.NewReplacer(
+	"<afm_called_by>123456783</afm_called_by>", "<afm_called_by>987654324</afm_called_by>",
+	"<afm_called_by_fullname>ΠΑΠΑΔΟΠΟΥΛΟΣ ΓΕΩΡΓΙΟΣ</afm_called_by_fullname>", "<afm_called_by_fullname>ΕΤΑΙΡΕΙΑ ΠΕΛΑΤΗ ΑΕ</afm_called_by_fullname>",
+).Replace(testVATInfoResponse)
+
+func TestDelegation(t *testing.T) {
+
+	c := newTestClient(t, respond(testDelegatedResponse))
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.OnBehalfOf = "987654324"
+
+	i, err := c.Lookup("", "094014298")
+	if err != nil {
+		t.Fatalf("error looking up on behalf of client: %s", err)
+	}
+	if !i.CalledBy.Delegated() {
+		t.Errorf("expected a delegated call: %+v", i.CalledBy)
+	}
+
+	c.OnBehalfOf = "111111114"
+	_, err = c.Lookup("", "094014298")
+	if !errors.Is(err, ErrDelegationMismatch) {
+		t.Fatalf("expected delegation mismatch, got: %v", err)
+	}
+
+	var de *DelegationError
+	if !errors.As(err, &de) || de.Identity.AFMCalledBy != "987654324" {
+		t.Errorf("expected echoed identity in error: %+v", de)
+	}
+}
+
+func TestDelegationErrors(t *testing.T) {
+
+	codes := map[string]error{
+		"RG_WS_PUBLIC_AFM_CALLED_BY_NOT_FOUND":  ErrCalledByNotFound,
+		"RG_WS_PUBLIC_TOKEN_AFM_NOT_AUTHORIZED": ErrNotAuthorized,
+	}
+
+	for code, wanted := range codes {
+		c := newTestClient(t, respond(testErrorResponse(code)))
+
+		_, err := c.GetVATInfo("987654324", "094014298", "username", "password")
+		if !errors.Is(err, wanted) {
+			t.Errorf("unexpected error for %s, got: %v", code, err)
+			continue
+		}
+
+		var de *DelegationError
+		if errors.As(err, &de) && (de.Cause == nil || de.Cause.Code != code) {
+			t.Errorf("unexpected cause for %s: %+v", code, de.Cause)
+		}
+	}
+
+	// other codes stay service errors
+	c := newTestClient(t, respond(testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF")))
+	_, err := c.GetVATInfo("", "094014298", "username", "password")
+	var se *ServiceError
+	if !errors.As(err, &se) || se.Code != "RG_WS_PUBLIC_TAXPAYER_NF" {
+		t.Errorf("expected service error, got: %v", err)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+
+	// the identity is echoed even when calledfor is not found
+	notFound := strings.Replace(testDelegatedResponse,
+		"<error_code xsi:nil=\"true\"/>", "<error_code>RG_WS_PUBLIC_TAXPAYER_NF</error_code>", 1)
+
+	c := newTestClient(t, respond(notFound))
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.OnBehalfOf = "987654324"
+
+	id, err := c.WhoAmI("123456783")
+	if err != nil {
+		t.Fatalf("error getting identity: %s", err)
+	}
+
+	if id.TokenUsername != "USERNAME1" || id.TokenAFM != "123456783" || id.AFMCalledByFullName != "ΕΤΑΙΡΕΙΑ ΠΕΛΑΤΗ ΑΕ" {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+
+	c = newTestClient(t, respond(testErrorResponse("RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED")))
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	if _, err := c.WhoAmI("123456783"); err == nil || err.Error() != "service error RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED" {
+		t.Errorf("expected authentication error, got: %v", err)
+	}
+}
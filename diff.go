@@ -0,0 +1,137 @@
+package rgwspublic
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldChange is a difference of one field between two snapshots
+// Path uses json names, e.g. result.postal_zip_code or activities[64191204].kind
+type FieldChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// Changeset is the list of differences between two snapshots
+// it renders as text with String and as json with json.Marshal
+type Changeset []FieldChange
+
+// String renders one change per line, for humans
+func (cs Changeset) String() string {
+
+	var b strings.Builder
+	for _, c := range cs {
+		fmt.Fprintf(&b, "%s: %s -> %s\n", c.Path, orNone(c.Old), orNone(c.New))
+	}
+
+	return b.String()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return strconv.Quote(s)
+}
+
+// Diff returns the field changes from old to new
+// whitespace padding, CallSeqID and the caller identity are ignored
+// text is compared in its NormalizeGreek form, so accents, case and latin look-alikes
+// are not changes, the changes hold the values as returned with whitespace squashed
+// activities are compared as a set keyed by code, so added, removed
+// and changed activities are reported separately
+// a nil snapshot is treated as an empty one
+func Diff(old, new *VATInfo) Changeset {
+
+	if old == nil {
+		old = &VATInfo{}
+	}
+	if new == nil {
+		new = &VATInfo{}
+	}
+
+	var cs Changeset
+
+	// basic record, field by field in declaration order
+	ov, nv := reflect.ValueOf(old.Result), reflect.ValueOf(new.Result)
+	for i := 0; i < ov.NumField(); i++ {
+		o, n := squash(ov.Field(i).String()), squash(nv.Field(i).String())
+		if NormalizeGreek(o) != NormalizeGreek(n) {
+			cs = append(cs, FieldChange{Path: "result." + jsonName(ov.Type().Field(i)), Old: o, New: n})
+		}
+	}
+
+	// activities as a set keyed by code
+	oa, na := activitiesByCode(old.Activities), activitiesByCode(new.Activities)
+	codes := []int{}
+	for code := range oa {
+		codes = append(codes, code)
+	}
+	for code := range na {
+		if _, ok := oa[code]; !ok {
+			codes = append(codes, code)
+		}
+	}
+	sort.Ints(codes)
+
+	for _, code := range codes {
+
+		path := "activities[" + strconv.Itoa(code) + "]"
+		o, inOld := oa[code]
+		n, inNew := na[code]
+
+		switch {
+		case !inOld:
+			cs = append(cs, FieldChange{Path: path, New: describeActivity(n)})
+		case !inNew:
+			cs = append(cs, FieldChange{Path: path, Old: describeActivity(o)})
+		default:
+			if o.Kind != n.Kind {
+				cs = append(cs, FieldChange{Path: path + ".kind", Old: kindName(o), New: kindName(n)})
+			}
+			if d1, d2 := squash(o.Descriptionn), squash(n.Descriptionn); NormalizeGreek(d1) != NormalizeGreek(d2) {
+				cs = append(cs, FieldChange{Path: path + ".description", Old: d1, New: d2})
+			}
+		}
+	}
+
+	return cs
+}
+
+// squash trims and collapses whitespace
+func squash(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func activitiesByCode(acts []FirmActivity) map[int]FirmActivity {
+	m := make(map[int]FirmActivity, len(acts))
+	for _, a := range acts {
+		m[a.Code] = a
+	}
+	return m
+}
+
+// describeActivity formats an activity as description (kind)
+func describeActivity(a FirmActivity) string {
+	return squash(a.Descriptionn) + " (" + kindName(a) + ")"
+}
+
+// kindName returns the kind description of an activity, or its number if missing
+func kindName(a FirmActivity) string {
+	if d := squash(a.KindDescr); d != "" {
+		return d
+	}
+	return strconv.Itoa(a.Kind)
+}
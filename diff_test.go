@@ -0,0 +1,76 @@
+package rgwspublic
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testSnapshot(t *testing.T, body string) *VATInfo {
+	b, err := decodeXML([]byte(body))
+	if err != nil {
+		t.Fatalf("error decoding snapshot: %s", err)
+	}
+	return &b.VATInfo
+}
+
+func TestDiff(t *testing.T) {
+
+	old := testSnapshot(t, testVATInfoResponse)
+
+	// padding, accents, case, latin look-alikes and call sequence differences are not changes
+	padded := testSnapshot(t, strings.NewReplacer(
+		"<onomasia>ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ</onomasia>", "<onomasia>ΤΡΑΠΕΖΑ  Πειραιώς ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ   </onomasia>",
+		"ΥΠΗΡΕΣΙΕΣ ΤΡΑΠΕΖΩΝ", "YΠΗΡΕΣΙΕΣ ΤΡAΠΕΖΩΝ",
+		"<call_seq_id>46447592</call_seq_id>", "<call_seq_id>46447599</call_seq_id>",
+		"<as_on_date>2021-11-22+02:00</as_on_date>", "<as_on_date>2022-03-02+02:00</as_on_date>",
+	).Replace(testVATInfoResponse))
+	if cs := Diff(old, padded); len(cs) != 0 {
+		t.Errorf("unexpected changes: %s", cs)
+	}
+
+	new := testSnapshot(t, strings.NewReplacer(
+		"<postal_address_no>4</postal_address_no>", "<postal_address_no>6</postal_address_no>",
+		"<firm_act_kind>1</firm_act_kind>", "<firm_act_kind>2</firm_act_kind>",
+		"<firm_act_kind_descr>ΚΥΡΙΑ</firm_act_kind_descr>", "<firm_act_kind_descr>ΔΕΥΤΕΡΕΥΟΥΣΑ</firm_act_kind_descr>",
+		"<firm_act_code>66191000</firm_act_code>", "<firm_act_code>66120000</firm_act_code>",
+	).Replace(testVATInfoResponse))
+
+	cs := Diff(old, new)
+	wanted := Changeset{
+		{Path: "result.postal_address_no", Old: "4", New: "6"},
+		{Path: "activities[64191204].kind", Old: "ΚΥΡΙΑ", New: "ΔΕΥΤΕΡΕΥΟΥΣΑ"},
+		{Path: "activities[66120000]", New: "ΥΠΗΡΕΣΙΕΣ ΜΕΣΙΤΩΝ ΧΡΗΜΑΤΙΣΤΗΡΙΟΥ (ΔΕΥΤΕΡΕΥΟΥΣΑ)"},
+		{Path: "activities[66191000]", Old: "ΥΠΗΡΕΣΙΕΣ ΜΕΣΙΤΩΝ ΧΡΗΜΑΤΙΣΤΗΡΙΟΥ (ΔΕΥΤΕΡΕΥΟΥΣΑ)"},
+	}
+	if len(cs) != len(wanted) {
+		t.Fatalf("unexpected changes:\n%s", cs)
+	}
+	for i := range wanted {
+		if cs[i] != wanted[i] {
+			t.Errorf("unexpected change #%d, got: %+v, wanted: %+v", i, cs[i], wanted[i])
+		}
+	}
+
+	text := cs.String()
+	if !strings.Contains(text, `result.postal_address_no: "4" -> "6"`+"\n") ||
+		!strings.Contains(text, `activities[66191000]: "ΥΠΗΡΕΣΙΕΣ ΜΕΣΙΤΩΝ ΧΡΗΜΑΤΙΣΤΗΡΙΟΥ (ΔΕΥΤΕΡΕΥΟΥΣΑ)" -> (none)`) {
+		t.Errorf("unexpected text rendering:\n%s", text)
+	}
+
+	js, err := json.Marshal(cs)
+	if err != nil {
+		t.Fatalf("error marshaling changes: %s", err)
+	}
+	if !strings.HasPrefix(string(js), `[{"path":"result.postal_address_no","old":"4","new":"6"}`) {
+		t.Errorf("unexpected json rendering: %s", js)
+	}
+}
+
+func TestDiffNil(t *testing.T) {
+
+	cs := Diff(nil, testSnapshot(t, testVATInfoResponse))
+	if len(cs) == 0 || cs[0].Path != "result.afm" || cs[0].New != "094014298" {
+		t.Errorf("unexpected changes from nil: %s", cs)
+	}
+}
@@ -0,0 +1,83 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sync"
+)
+
+// the vat info envelope, split around its four values
+const (
+	vatInfoEnvelopeUsername = `<?xml version="1.0" encoding="UTF-8"?>
+		<env:Envelope
+			xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+			xmlns:ns1="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+			xmlns:ns2="http://rgwspublic2/RgWsPublic2Service"
+			xmlns:ns3="http://rgwspublic2/RgWsPublic2">
+			<env:Header>
+	   			<ns1:Security>
+		  			<ns1:UsernameToken>
+			 			<ns1:Username>`
+	vatInfoEnvelopePassword = `</ns1:Username>
+			 			<ns1:Password>`
+	vatInfoEnvelopeCalledBy = `</ns1:Password>
+		  			</ns1:UsernameToken>
+	   			</ns1:Security>
+			</env:Header>
+			<env:Body>
+	   			<ns2:rgWsPublic2AfmMethod>
+		  			<ns2:INPUT_REC>
+						<ns3:afm_called_by>`
+	vatInfoEnvelopeCalledFor = `</ns3:afm_called_by>
+			 			<ns3:afm_called_for>`
+	vatInfoEnvelopeEnd = `</ns3:afm_called_for>
+		  			</ns2:INPUT_REC>
+	   			</ns2:rgWsPublic2AfmMethod>
+			</env:Body>
+ 		</env:Envelope>`
+)
+
+// envelopes are built in pooled buffers, bulk jobs build thousands of them
+var envelopePool = sync.Pool{
+	New: func() interface{} {
+		b := &bytes.Buffer{}
+		b.Grow(len(vatInfoEnvelopeUsername) + len(vatInfoEnvelopePassword) + len(vatInfoEnvelopeCalledBy) +
+			len(vatInfoEnvelopeCalledFor) + len(vatInfoEnvelopeEnd) + 128)
+		return b
+	},
+}
+
+// vatInfoEnvelope returns the soap envelope of a vat info call, values are escaped
+func vatInfoEnvelope(username, password, calledby, calledfor string) string {
+
+	b := envelopePool.Get().(*bytes.Buffer)
+	b.Reset()
+
+	b.WriteString(vatInfoEnvelopeUsername)
+	writeEscaped(b, username)
+	b.WriteString(vatInfoEnvelopePassword)
+	writeEscaped(b, password)
+	b.WriteString(vatInfoEnvelopeCalledBy)
+	writeEscaped(b, calledby)
+	b.WriteString(vatInfoEnvelopeCalledFor)
+	writeEscaped(b, calledfor)
+	b.WriteString(vatInfoEnvelopeEnd)
+
+	s := b.String()
+	envelopePool.Put(b)
+	return s
+}
+
+// writeEscaped writes s as xml text, plain values are written as they are
+func writeEscaped(b *bytes.Buffer, s string) {
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<', '>', '&', '\'', '"', '\r', '\n', '\t':
+			xml.EscapeText(b, []byte(s))
+			return
+		}
+	}
+
+	b.WriteString(s)
+}
@@ -0,0 +1,49 @@
+package rgwspublic
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestVATInfoEnvelope(t *testing.T) {
+
+	body := vatInfoEnvelope("user", "p<a&ss", "", "094014298")
+
+	var env struct {
+		Username  string `xml:"Header>Security>UsernameToken>Username"`
+		Password  string `xml:"Header>Security>UsernameToken>Password"`
+		CalledBy  string `xml:"Body>rgWsPublic2AfmMethod>INPUT_REC>afm_called_by"`
+		CalledFor string `xml:"Body>rgWsPublic2AfmMethod>INPUT_REC>afm_called_for"`
+	}
+	if err := xml.Unmarshal([]byte(body), &env); err != nil {
+		t.Fatalf("envelope is not xml: %s", err)
+	}
+	if env.Username != "user" || env.Password != "p<a&ss" || env.CalledBy != "" || env.CalledFor != "094014298" {
+		t.Errorf("unexpected values: %+v", env)
+	}
+
+	// buffers are reused, strings are not
+	other := vatInfoEnvelope("another", "password", "123456789", "094014298")
+	if !strings.Contains(body, "<ns1:Username>user</ns1:Username>") || !strings.Contains(other, "<ns3:afm_called_by>123456789</ns3:afm_called_by>") {
+		t.Errorf("envelope changed after reuse of its buffer")
+	}
+}
+
+func TestVATInfoEnvelopeAllocs(t *testing.T) {
+
+	vatInfoEnvelope("username", "password", "", "094014298")
+	if n := testing.AllocsPerRun(100, func() {
+		vatInfoEnvelope("username", "password", "", "094014298")
+	}); n > 1 {
+		t.Errorf("building an envelope allocates %.0f times", n)
+	}
+}
+
+func BenchmarkVATInfoEnvelope(b *testing.B) {
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = vatInfoEnvelope("username", "password", "123456789", "094014298")
+	}
+}
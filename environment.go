@@ -0,0 +1,180 @@
+package rgwspublic
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// VIESTestEndpoint is the test service of VIES, answering for fixed test numbers
+const VIESTestEndpoint = "https://ec.europa.eu/taxation_customs/vies/services/checkVatTestService"
+
+// environment names
+const (
+	EnvironmentProduction = "production"
+	EnvironmentTest       = "test"
+	EnvironmentCustom     = "custom"
+)
+
+// environment variables read by EnvironmentFromEnv
+const (
+	EnvEnvironment = "GSISEnvironment"
+	EnvEndpoint    = "GSISEndpoint"
+	EnvCAFile      = "GSISCAFile"
+)
+
+// environment variables holding the credentials of the test and custom environments,
+// so credentials of one environment are never sent to another
+// production uses EnvUsername and EnvPassword
+const (
+	EnvTestUsername   = "GSISTestUsername"
+	EnvTestPassword   = "GSISTestPassword"
+	EnvCustomUsername = "GSISCustomUsername"
+	EnvCustomPassword = "GSISCustomPassword"
+)
+
+var (
+	ErrUnknownEnvironment = errors.New("unknown environment")
+	ErrNoEndpoint         = errors.New("environment needs an endpoint")
+)
+
+// Environment is a service to talk to, with its own TLS settings and credentials
+type Environment struct {
+	Name string
+
+	// Endpoint of the GSIS service
+	Endpoint string
+
+	// VIESEndpoint of the VIES service, the package VIESEndpoint if empty
+	VIESEndpoint string
+
+	// TLSConfig for the connections, the system defaults if nil
+	TLSConfig *tls.Config
+
+	// Credentials of the environment, can be nil
+	Credentials CredentialsProvider
+}
+
+// Production is the service of AADE at www1.gsis.gr, with credentials from EnvUsername and EnvPassword
+var Production = Environment{
+	Name:         EnvironmentProduction,
+	Endpoint:     Endpoint,
+	VIESEndpoint: VIESEndpoint,
+	Credentials:  EnvCredentials{},
+}
+
+// TestEnvironment is a test host of the service at endpoint, paired with the VIES test service
+// with credentials from EnvTestUsername and EnvTestPassword
+func TestEnvironment(endpoint string) Environment {
+	return Environment{
+		Name:         EnvironmentTest,
+		Endpoint:     endpoint,
+		VIESEndpoint: VIESTestEndpoint,
+		Credentials:  EnvCredentials{UsernameVar: EnvTestUsername, PasswordVar: EnvTestPassword},
+	}
+}
+
+// CustomEnvironment is a service at endpoint, e.g. a stand-in for integration tests
+// with credentials from EnvCustomUsername and EnvCustomPassword
+func CustomEnvironment(endpoint string) Environment {
+	return Environment{
+		Name:        EnvironmentCustom,
+		Endpoint:    endpoint,
+		Credentials: EnvCredentials{UsernameVar: EnvCustomUsername, PasswordVar: EnvCustomPassword},
+	}
+}
+
+// LookupEnvironment returns the environment by name, as selected by a flag
+// test and custom need an endpoint, a url given as the name is a custom environment
+// and so is production with another endpoint, so production credentials stay with production
+// credentials are read from the variables of the environment
+func LookupEnvironment(name, endpoint string) (Environment, error) {
+
+	var env Environment
+	switch name = strings.ToLower(strings.TrimSpace(name)); name {
+	case "", EnvironmentProduction:
+		env = Production
+		if endpoint != "" && endpoint != Endpoint {
+			env = CustomEnvironment(endpoint)
+		}
+	case EnvironmentTest:
+		env = TestEnvironment(endpoint)
+	case EnvironmentCustom:
+		env = CustomEnvironment(endpoint)
+	default:
+		if u, err := url.Parse(name); err != nil || u.Scheme == "" || u.Host == "" {
+			return Environment{}, fmt.Errorf("%w: %s", ErrUnknownEnvironment, name)
+		}
+		env = CustomEnvironment(name)
+	}
+
+	if env.Endpoint == "" {
+		return Environment{}, fmt.Errorf("%w: %s", ErrNoEndpoint, env.Name)
+	}
+
+	return env, nil
+}
+
+// EnvironmentFromEnv returns the environment selected by the EnvEnvironment, EnvEndpoint
+// and EnvCAFile variables, production if none is set
+func EnvironmentFromEnv() (Environment, error) {
+
+	env, err := LookupEnvironment(os.Getenv(EnvEnvironment), os.Getenv(EnvEndpoint))
+	if err != nil {
+		return env, err
+	}
+
+	if path := os.Getenv(EnvCAFile); path != "" {
+		return env.WithCAFile(path)
+	}
+
+	return env, nil
+}
+
+// WithCAFile returns the environment trusting the PEM certificates of path,
+// e.g. those of a stand-in with a self signed certificate
+func (e Environment) WithCAFile(path string) (Environment, error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return e, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return e, fmt.Errorf("no certificates in %s", path)
+	}
+
+	cfg := &tls.Config{}
+	if e.TLSConfig != nil {
+		cfg = e.TLSConfig.Clone()
+	}
+	cfg.RootCAs = pool
+	e.TLSConfig = cfg
+
+	return e, nil
+}
+
+// NewClientFor returns a client for the environment
+func NewClientFor(env Environment) *Client {
+
+	hc := http.DefaultClient
+	if env.TLSConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = env.TLSConfig
+		hc = &http.Client{Transport: t}
+	}
+
+	return &Client{
+		HTTPClient:   hc,
+		Endpoint:     env.Endpoint,
+		VIESEndpoint: env.VIESEndpoint,
+		Credentials:  env.Credentials,
+	}
+}
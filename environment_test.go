@@ -0,0 +1,128 @@
+package rgwspublic
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupEnvironment(t *testing.T) {
+
+	env, err := LookupEnvironment("", "")
+	if err != nil || env.Name != EnvironmentProduction || env.Endpoint != Endpoint || env.Credentials == nil {
+		t.Errorf("expected production, got: %+v %v", env, err)
+	}
+
+	env, err = LookupEnvironment("Test", "https://gsis.test.example/RgWsPublic2")
+	if err != nil || env.Name != EnvironmentTest || env.Endpoint != "https://gsis.test.example/RgWsPublic2" || env.VIESEndpoint != VIESTestEndpoint {
+		t.Errorf("unexpected test environment: %+v %v", env, err)
+	}
+
+	// production credentials are not sent to a test host
+	t.Setenv(EnvUsername, "produser")
+	t.Setenv(EnvPassword, "prodpass")
+	t.Setenv(EnvTestUsername, "testuser")
+	t.Setenv(EnvTestPassword, "testpass")
+	if c, err := env.Credentials.Credentials(); err != nil || c.Username != "testuser" {
+		t.Errorf("unexpected test credentials: %v %v", c, err)
+	}
+	if c, err := Production.Credentials.Credentials(); err != nil || c.Username != "produser" {
+		t.Errorf("unexpected production credentials: %v %v", c, err)
+	}
+
+	env, err = LookupEnvironment("http://localhost:8080/stand-in", "")
+	if err != nil || env.Name != EnvironmentCustom || env.Endpoint != "http://localhost:8080/stand-in" {
+		t.Errorf("unexpected custom environment: %+v %v", env, err)
+	}
+
+	if _, err := LookupEnvironment("test", ""); !errors.Is(err, ErrNoEndpoint) {
+		t.Errorf("expected an error for a test environment without endpoint, got: %v", err)
+	}
+	if _, err := LookupEnvironment("staging", ""); !errors.Is(err, ErrUnknownEnvironment) {
+		t.Errorf("expected an unknown environment, got: %v", err)
+	}
+}
+
+func TestEnvironmentFromEnv(t *testing.T) {
+
+	srv := httptest.NewTLSServer(respond(testVATInfoResponse))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(path, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvEnvironment, EnvironmentCustom)
+	t.Setenv(EnvEndpoint, srv.URL)
+	t.Setenv(EnvCustomUsername, "username")
+	t.Setenv(EnvCustomPassword, "password")
+
+	// the stand-in's certificate is not trusted by default
+	t.Setenv(EnvCAFile, "")
+	env, err := EnvironmentFromEnv()
+	if err != nil {
+		t.Fatalf("error reading environment: %s", err)
+	}
+	if _, err := NewClientFor(env).Lookup("", "094014298"); err == nil {
+		t.Errorf("expected a certificate error")
+	}
+
+	t.Setenv(EnvCAFile, path)
+	env, err = EnvironmentFromEnv()
+	if err != nil {
+		t.Fatalf("error reading environment: %s", err)
+	}
+	i, err := NewClientFor(env).Lookup("", "094014298")
+	if err != nil || i.Result.AFM != "094014298" {
+		t.Errorf("unexpected lookup: %+v %v", i, err)
+	}
+
+	t.Setenv(EnvCAFile, filepath.Join(t.TempDir(), "missing.pem"))
+	if _, err := EnvironmentFromEnv(); err == nil {
+		t.Errorf("expected an error for a missing ca file")
+	}
+}
+
+func TestProductionEndpointOverride(t *testing.T) {
+
+	var user string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(b), "produser") {
+			user = "produser"
+		}
+		respond(testVATInfoResponse)(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Setenv(EnvEnvironment, "")
+	t.Setenv(EnvEndpoint, srv.URL)
+	t.Setenv(EnvCAFile, "")
+	t.Setenv(EnvUsername, "produser")
+	t.Setenv(EnvPassword, "prodpass")
+	t.Setenv(EnvCustomUsername, "")
+	t.Setenv(EnvCustomPassword, "")
+
+	env, err := EnvironmentFromEnv()
+	if err != nil {
+		t.Fatalf("error reading environment: %s", err)
+	}
+	if env.Name != EnvironmentCustom {
+		t.Errorf("production kept with another endpoint: %+v", env)
+	}
+
+	if _, err := NewClientFor(env).Lookup("", "094014298"); err == nil || user != "" {
+		t.Errorf("production credentials sent to %s: %v", srv.URL, err)
+	}
+
+	if env, err := LookupEnvironment(EnvironmentProduction, Endpoint); err != nil || env.Name != EnvironmentProduction {
+		t.Errorf("unexpected production environment: %+v %v", env, err)
+	}
+}
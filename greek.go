@@ -0,0 +1,171 @@
+package rgwspublic
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// combining marks of greek text
+const (
+	combiningGrave         = '\u0300'
+	combiningAcute         = '\u0301' // tonos
+	combiningDiaeresis     = '\u0308' // dialytika
+	combiningPsili         = '\u0313'
+	combiningDasia         = '\u0314'
+	combiningPerispomeni   = '\u0342'
+	combiningYpogegrammeni = '\u0345'
+)
+
+// latin letters that look like greek ones
+var homoglyphs = map[rune]rune{
+	'A': 'Α', 'B': 'Β', 'E': 'Ε', 'Z': 'Ζ', 'H': 'Η', 'I': 'Ι', 'K': 'Κ', 'M': 'Μ',
+	'N': 'Ν', 'O': 'Ο', 'P': 'Ρ', 'T': 'Τ', 'Y': 'Υ', 'X': 'Χ',
+	'a': 'α', 'i': 'ι', 'k': 'κ', 'o': 'ο', 'p': 'ρ', 'u': 'υ', 'v': 'ν', 'x': 'χ',
+}
+
+// NFC composes accented letters, Ά as one rune
+func NFC(s string) string {
+	return norm.NFC.String(s)
+}
+
+// NFD decomposes accented letters, Ά as Α and a combining acute
+func NFD(s string) string {
+	return norm.NFD.String(s)
+}
+
+// StripAccents removes tonos, dialytika and any other combining marks
+func StripAccents(s string) string {
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return norm.NFC.String(b.String())
+}
+
+// GreekUpper uppercases greek text the way greek is written in capitals, without tonos
+// a vowel losing its tonos before ι or υ gives them a dialytika, μάιος is ΜΑΪΟΣ
+func GreekUpper(s string) string {
+
+	rs := []rune(norm.NFD.String(s))
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch r {
+		case combiningAcute, combiningGrave, combiningPerispomeni:
+			// the next letter would form a diphthong without the accent
+			if i > 0 && i+1 < len(rs) && isDiphthongStart(rs[i-1]) && isDiphthongEnd(rs[i+1]) &&
+				(i+2 >= len(rs) || !unicode.Is(unicode.Mn, rs[i+2])) {
+				b.WriteRune(unicode.ToUpper(rs[i+1]))
+				b.WriteRune(combiningDiaeresis)
+				i++
+			}
+		case combiningPsili, combiningDasia, combiningYpogegrammeni:
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+
+	return norm.NFC.String(b.String())
+}
+
+// GreekLower lowercases greek text keeping its accents, with ς ending words
+func GreekLower(s string) string {
+
+	rs := []rune(strings.ToLower(s))
+	for i, r := range rs {
+		if r == 'σ' && i > 0 && isLetter(rs[i-1]) && (i+1 == len(rs) || !isLetter(rs[i+1])) {
+			rs[i] = 'ς'
+		}
+	}
+
+	return string(rs)
+}
+
+// FoldHomoglyphs replaces latin letters that look greek with the greek ones,
+// only in words that have greek letters, so latin words are kept
+func FoldHomoglyphs(s string) string {
+
+	rs := []rune(s)
+	for start := 0; start < len(rs); {
+		end := start
+		greek := false
+		for end < len(rs) && isLetter(rs[end]) {
+			greek = greek || unicode.Is(unicode.Greek, rs[end])
+			end++
+		}
+
+		if greek {
+			for i := start; i < end; i++ {
+				if g, ok := homoglyphs[rs[i]]; ok {
+					rs[i] = g
+				}
+			}
+		}
+
+		start = end + 1
+	}
+
+	return string(rs)
+}
+
+// CollapseSpace trims and collapses whitespace, including no-break spaces, to single spaces
+func CollapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// NormalizeGreek returns the form greek text is compared in,
+// homoglyphs folded, accents stripped, uppercase and whitespace collapsed
+// ΑΘΗΝΑ, Αθήνα and Aθηνα (with a latin A) all are ΑΘΗΝΑ
+func NormalizeGreek(s string) string {
+	return CollapseSpace(strings.ToUpper(StripAccents(FoldHomoglyphs(norm.NFC.String(s)))))
+}
+
+// NormalizedInfo holds the text fields of a VATInfo in their NormalizeGreek form
+type NormalizedInfo struct {
+	Onomasia               string   `json:"onomasia"`
+	CommercialTitle        string   `json:"commercial_title"`
+	LegalStatusDescription string   `json:"legal_status_descr"`
+	DOYDescription         string   `json:"doy_description"`
+	PostalAddress          string   `json:"postal_address"`
+	PostalAreaDescription  string   `json:"postal_area_description"`
+	Activities             []string `json:"activities"` // descriptions, in the order of VATInfo.Activities
+}
+
+// Normalize sets Normalized from the text fields of the record
+func (a *VATInfo) Normalize() {
+
+	n := &NormalizedInfo{
+		Onomasia:               NormalizeGreek(a.Result.Onomasia),
+		CommercialTitle:        NormalizeGreek(a.Result.CommercialTitle),
+		LegalStatusDescription: NormalizeGreek(a.Result.LegalStatusDescription),
+		DOYDescription:         NormalizeGreek(a.Result.DOYDescription),
+		PostalAddress:          NormalizeGreek(a.Result.PostalAddress),
+		PostalAreaDescription:  NormalizeGreek(a.Result.PostalAreaDescription),
+	}
+	for _, act := range a.Activities {
+		n.Activities = append(n.Activities, NormalizeGreek(act.Descriptionn))
+	}
+
+	a.Normalized = n
+}
+
+func isDiphthongStart(r rune) bool {
+	return strings.ContainsRune("αεουΑΕΟΥ", r)
+}
+
+func isDiphthongEnd(r rune) bool {
+	return strings.ContainsRune("ιυΙΥ", r)
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r)
+}
@@ -0,0 +1,87 @@
+package rgwspublic
+
+import (
+	"testing"
+)
+
+func TestGreekUpper(t *testing.T) {
+
+	tests := map[string]string{
+		"Αθήνα":        "ΑΘΗΝΑ",
+		"μάιος":        "ΜΑΪΟΣ",
+		"ρολόι":        "ΡΟΛΟΪ",
+		"καΐκι":        "ΚΑΪΚΙ",
+		"άυλος":        "ΑΫΛΟΣ",
+		"αύριο":        "ΑΥΡΙΟ",
+		"ευχαριστώ":    "ΕΥΧΑΡΙΣΤΩ",
+		"Ἀθῆναι":       "ΑΘΗΝΑΙ",
+		"οδός Ερμού 4": "ΟΔΟΣ ΕΡΜΟΥ 4",
+	}
+	for in, want := range tests {
+		if got := GreekUpper(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestGreekLower(t *testing.T) {
+
+	tests := map[string]string{
+		"ΟΔΟΣ ΑΘΗΝΑΣ":   "οδος αθηνας",
+		"ΟΔΟΣ ΑΘΗΝΑΣ.":  "οδος αθηνας.",
+		"ΣΟΦΟΣ-ΣΟΦΟΣ":   "σοφος-σοφος",
+		"Σ":             "σ",
+		"ΜΆΙΟΣ":         "μάιος",
+		"ΠΕΙΡΑΙΩΣ Α.Ε.": "πειραιως α.ε.",
+	}
+	for in, want := range tests {
+		if got := GreekLower(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeGreek(t *testing.T) {
+
+	tests := map[string]string{
+		"Αθήνα":                     "ΑΘΗΝΑ",
+		"Aθηνα":                     "ΑΘΗΝΑ", // latin A
+		"ΤΡΑΠΕZΑ  ΠΕΙΡΑΙΩΣ ":        "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ",
+		"\u0391\u0301γιος Νικόλαος": "ΑΓΙΟΣ ΝΙΚΟΛΑΟΣ", // decomposed
+		"καΐκι":                     "ΚΑΙΚΙ",
+		"ACME ΑΕ":                   "ACME ΑΕ",
+	}
+	for in, want := range tests {
+		if got := NormalizeGreek(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+
+	if NFC("\u0391\u0301") != "\u0386" || NFD("\u0386") != "\u0391\u0301" || StripAccents("ΐ") != "ι" {
+		t.Errorf("unexpected normalization forms")
+	}
+}
+
+func TestFoldHomoglyphs(t *testing.T) {
+
+	if got := FoldHomoglyphs("KAΦEΣ and COFFEE"); got != "ΚΑΦΕΣ and COFFEE" {
+		t.Errorf("unexpected folding: %s", got)
+	}
+}
+
+func TestNormalizedInfo(t *testing.T) {
+
+	i := testSnapshot(t, testVATInfoResponse)
+	n := i.Normalized
+	if n == nil {
+		t.Fatalf("no normalized form attached")
+	}
+	if n.Onomasia != "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ" || n.PostalAddress != "ΑΜΕΡΙΚΗΣ" ||
+		len(n.Activities) != 2 || n.Activities[1] != "ΥΠΗΡΕΣΙΕΣ ΜΕΣΙΤΩΝ ΧΡΗΜΑΤΙΣΤΗΡΙΟΥ" {
+		t.Errorf("unexpected normalized form: %+v", n)
+	}
+
+	if testSnapshot(t, testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF")).Normalized != nil {
+		t.Errorf("normalized form attached to an error")
+	}
+}
@@ -0,0 +1,642 @@
+package rgwspublic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("no lookup found")
+
+// DefaultSegmentSize is the size a history segment grows to before a new one is started
+const DefaultSegmentSize = 64 << 20
+
+const (
+	historyIndexFile = "index.json"
+	segmentSuffix    = ".jsonl"
+	compactSuffix    = ".compact"
+	tmpSuffix        = ".tmp"
+)
+
+// HistoryRecord is a lookup as stored in the history
+type HistoryRecord struct {
+	Time      time.Time `json:"time"`
+	CalledBy  string    `json:"called_by,omitempty"`
+	AFM       string    `json:"afm"`
+	Info      *VATInfo  `json:"info,omitempty"` // nil if the lookup failed
+	ErrorCode string    `json:"error_code,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// historyEntry locates a record in a segment
+type historyEntry struct {
+	Time time.Time `json:"t"`
+	Seg  int       `json:"s"`
+	Off  int64     `json:"o"`
+	Len  int       `json:"l"`
+	OK   bool      `json:"ok"` // record has info
+}
+
+type historyIndex struct {
+	Sizes   map[int]int64             `json:"sizes"` // bytes indexed per segment
+	Entries map[string][]historyEntry `json:"entries"`
+}
+
+// History is an append-only log of lookups, stored as jsonl segments in a directory
+// an index of records per AFM is kept in memory and saved on Close,
+// records appended after the last save are indexed again on open
+type History struct {
+	// SegmentSize in bytes, DefaultSegmentSize if zero
+	SegmentSize int64
+
+	dir string
+
+	mu    sync.Mutex
+	index historyIndex
+	seg   int // current segment
+	f     *os.File
+	size  int64
+	err   error // set once a compaction failed half way, the history must be opened again
+}
+
+// OpenHistory opens or creates a history in dir
+func OpenHistory(dir string) (*History, error) {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	h := &History{dir: dir}
+	if err := h.finishCompaction(); err != nil {
+		return nil, err
+	}
+
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Append a record to the history, Time is set to now if zero
+func (h *History) Append(r HistoryRecord) error {
+
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.AFM = strings.TrimSpace(r.AFM)
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return h.err
+	}
+
+	max := h.SegmentSize
+	if max == 0 {
+		max = DefaultSegmentSize
+	}
+	if h.size > 0 && h.size+int64(len(b)) > max {
+		if err := h.roll(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := h.f.Write(b); err != nil {
+		return err
+	}
+	if err := h.f.Sync(); err != nil {
+		return err
+	}
+
+	h.add(r.AFM, historyEntry{Time: r.Time, Seg: h.seg, Off: h.size, Len: len(b), OK: r.Info != nil})
+	h.size += int64(len(b))
+	h.index.Sizes[h.seg] = h.size
+
+	return nil
+}
+
+// Record appends a lookup made by a client, service errors are recorded with their code
+func (h *History) Record(calledby, afm string, info *VATInfo, err error) error {
+
+	r := HistoryRecord{CalledBy: calledby, AFM: afm, Info: info}
+	if err != nil {
+		r.Info = nil
+		r.Error = err.Error()
+
+		var se *ServiceError
+		var de *DelegationError
+		switch {
+		case errors.As(err, &se):
+			r.ErrorCode = se.Code
+		case errors.As(err, &de) && de.Cause != nil:
+			r.ErrorCode = de.Cause.Code
+		}
+	}
+
+	return h.Append(r)
+}
+
+// Latest returns the last lookup of an AFM, successful or not
+func (h *History) Latest(afm string) (*HistoryRecord, error) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	entries := h.index.Entries[strings.TrimSpace(afm)]
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return h.read(entries[len(entries)-1])
+}
+
+// AsOf returns the last successful lookup of an AFM made at or before t,
+// that is the state of the AFM as the registry reported it at t
+func (h *History) AsOf(afm string, t time.Time) (*HistoryRecord, error) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	entries := h.index.Entries[strings.TrimSpace(afm)]
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].OK && !entries[i].Time.After(t) {
+			return h.read(entries[i])
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// Between returns all lookups made in [from, to), oldest first
+func (h *History) Between(from, to time.Time) ([]HistoryRecord, error) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	var found []historyEntry
+	for _, entries := range h.index.Entries {
+		for _, e := range entries {
+			if !e.Time.Before(from) && e.Time.Before(to) {
+				found = append(found, e)
+			}
+		}
+	}
+	sortEntries(found)
+
+	records := make([]HistoryRecord, 0, len(found))
+	for _, e := range found {
+		r, err := h.read(e)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *r)
+	}
+
+	return records, nil
+}
+
+// Export writes all records as jsonl, oldest first
+func (h *History) Export(w io.Writer) error {
+
+	records, err := h.Between(time.Time{}, time.Unix(1<<62, 0))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compact drops the records made before t, keeping the last successful
+// lookup of each AFM before t, so AsOf still answers for t and later
+// segments are merged, compaction resumes on open if interrupted
+// if it fails once old segments are removed, the history must be opened again
+func (h *History) Compact(t time.Time) error {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil {
+		return h.err
+	}
+
+	// the records to keep, in time order
+	var keep []historyEntry
+	for _, entries := range h.index.Entries {
+		last := -1
+		for i, e := range entries {
+			if e.Time.Before(t) && e.OK {
+				last = i
+			}
+		}
+		for i, e := range entries {
+			if i == last || !e.Time.Before(t) {
+				keep = append(keep, e)
+			}
+		}
+	}
+	sortEntries(keep)
+
+	// written to a temporary file, renamed to a compacted file once complete,
+	// which then replaces all current segments
+	target := h.seg + 1
+	compacted := h.segmentPath(target) + compactSuffix
+	tmp := compacted + tmpSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, e := range keep {
+		b, err := h.readRaw(e)
+		if err == nil {
+			_, err = w.Write(b)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, compacted); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := syncDir(h.dir); err != nil {
+		return err
+	}
+
+	// the current segment stays open until the compacted one is installed,
+	// from then on old segments may be gone and the index is rebuilt from the disk
+	old := h.f
+	err = h.finishCompaction()
+	if err == nil {
+		err = h.load()
+	}
+	if h.f != old {
+		old.Close()
+	}
+	if err != nil {
+		h.err = fmt.Errorf("history unusable after a failed compaction, open it again: %w", err)
+		return h.err
+	}
+
+	return h.saveIndex()
+}
+
+// Close saves the index and closes the current segment
+func (h *History) Close() error {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// the index of an unusable history is not saved, it is rebuilt on open
+	var err error
+	if h.err == nil {
+		err = h.saveIndex()
+	}
+	if cerr := h.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// load indexes the segments on disk, from the saved index if it matches them,
+// and opens the last one
+func (h *History) load() error {
+
+	segs, err := h.segments()
+	if err != nil {
+		return err
+	}
+
+	// a missing or stale index is rebuilt from the segments
+	if !h.loadIndex(segs) {
+		h.index = historyIndex{Sizes: map[int]int64{}, Entries: map[string][]historyEntry{}}
+	}
+
+	for _, n := range segs {
+		if err := h.scan(n); err != nil {
+			return err
+		}
+	}
+
+	h.seg = 1
+	if len(segs) > 0 {
+		h.seg = segs[len(segs)-1]
+	}
+
+	return h.openSegment(h.seg)
+}
+
+func (h *History) add(afm string, e historyEntry) {
+
+	entries := append(h.index.Entries[afm], e)
+
+	// keep time order, records are usually appended in order
+	for i := len(entries) - 1; i > 0 && entries[i].Time.Before(entries[i-1].Time); i-- {
+		entries[i], entries[i-1] = entries[i-1], entries[i]
+	}
+
+	h.index.Entries[afm] = entries
+}
+
+// scan indexes the records of a segment past the indexed size
+// a partial last line, left by a crash, is cut off
+func (h *History) scan(n int) error {
+
+	path := h.segmentPath(n)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	off := h.index.Sizes[n]
+	if off > int64(len(b)) {
+		return fmt.Errorf("history segment %s is shorter than indexed", path)
+	}
+
+	for {
+		i := bytes.IndexByte(b[off:], '\n')
+		if i < 0 {
+			break
+		}
+
+		line := b[off : off+int64(i)+1]
+		r := HistoryRecord{}
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("history segment %s at %d: %s", path, off, err)
+		}
+
+		h.add(r.AFM, historyEntry{Time: r.Time, Seg: n, Off: off, Len: len(line), OK: r.Info != nil})
+		off += int64(len(line))
+	}
+
+	h.index.Sizes[n] = off
+	if off < int64(len(b)) {
+		return os.Truncate(path, off)
+	}
+
+	return nil
+}
+
+func (h *History) read(e historyEntry) (*HistoryRecord, error) {
+
+	b, err := h.readRaw(e)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &HistoryRecord{}
+	return r, json.Unmarshal(b, r)
+}
+
+func (h *History) readRaw(e historyEntry) ([]byte, error) {
+
+	f, err := os.Open(h.segmentPath(e.Seg))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, e.Len)
+	if _, err := f.ReadAt(b, e.Off); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (h *History) roll() error {
+
+	if err := h.f.Close(); err != nil {
+		return err
+	}
+
+	if err := h.saveIndex(); err != nil {
+		return err
+	}
+
+	h.seg++
+	return h.openSegment(h.seg)
+}
+
+func (h *History) openSegment(n int) error {
+
+	f, err := os.OpenFile(h.segmentPath(n), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	h.f, h.size = f, fi.Size()
+	return nil
+}
+
+// finishCompaction replaces the segments older than a compacted file with it
+func (h *History) finishCompaction() error {
+
+	// a compaction interrupted while writing is dropped
+	partial, err := filepath.Glob(filepath.Join(h.dir, "*"+segmentSuffix+compactSuffix+tmpSuffix))
+	if err != nil {
+		return err
+	}
+	for _, p := range partial {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+
+	matches, err := filepath.Glob(filepath.Join(h.dir, "*"+segmentSuffix+compactSuffix))
+	if err != nil || len(matches) == 0 {
+		return err
+	}
+
+	for _, m := range matches {
+
+		target, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(m), segmentSuffix+compactSuffix))
+		if err != nil {
+			continue
+		}
+
+		segs, err := h.segments()
+		if err != nil {
+			return err
+		}
+		for _, n := range segs {
+			if n < target {
+				if err := os.Remove(h.segmentPath(n)); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := os.Rename(m, h.segmentPath(target)); err != nil {
+			return err
+		}
+	}
+	if err := syncDir(h.dir); err != nil {
+		return err
+	}
+
+	// the index refers to removed segments
+	err = os.Remove(filepath.Join(h.dir, historyIndexFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// segments returns the numbers of segments on disk, in order
+func (h *History) segments() ([]int, error) {
+
+	matches, err := filepath.Glob(filepath.Join(h.dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	segs := []int{}
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(m), segmentSuffix))
+		if err == nil {
+			segs = append(segs, n)
+		}
+	}
+	sort.Ints(segs)
+
+	return segs, nil
+}
+
+func (h *History) segmentPath(n int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%06d%s", n, segmentSuffix))
+}
+
+// loadIndex reads the saved index, if it matches the segments on disk
+func (h *History) loadIndex(segs []int) bool {
+
+	b, err := ioutil.ReadFile(filepath.Join(h.dir, historyIndexFile))
+	if err != nil {
+		return false
+	}
+
+	if json.Unmarshal(b, &h.index) != nil || h.index.Sizes == nil || h.index.Entries == nil {
+		return false
+	}
+
+	for n, size := range h.index.Sizes {
+		if !containsInt(segs, n) {
+			return false
+		}
+		fi, err := os.Stat(h.segmentPath(n))
+		if err != nil || fi.Size() < size {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *History) saveIndex() error {
+
+	b, err := json.Marshal(h.index)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(h.dir, historyIndexFile), b)
+}
+
+func sortEntries(entries []historyEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Time.Equal(entries[j].Time) {
+			return entries[i].Time.Before(entries[j].Time)
+		}
+		if entries[i].Seg != entries[j].Seg {
+			return entries[i].Seg < entries[j].Seg
+		}
+		return entries[i].Off < entries[j].Off
+	})
+}
+
+func containsInt(s []int, n int) bool {
+	for _, v := range s {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// syncDir flushes the entries of a directory, so renames and removals survive a crash
+func syncDir(dir string) error {
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,261 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+
+	dir := t.TempDir()
+	h, err := OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error opening history: %s", err)
+	}
+	h.SegmentSize = 1024 // a few records per segment
+
+	day := func(d int) time.Time { return time.Date(2022, 3, d, 12, 0, 0, 0, time.UTC) }
+	info := testSnapshot(t, testVATInfoResponse)
+	moved := testSnapshot(t, testChangedResponse)
+
+	records := []HistoryRecord{
+		{Time: day(1), AFM: "094014298", Info: info},
+		{Time: day(2), AFM: "090165560", ErrorCode: "RG_WS_PUBLIC_TAXPAYER_NF"},
+		{Time: day(5), AFM: "094014298", Info: moved},
+		{Time: day(6), AFM: "094014298", ErrorCode: "RG_WS_PUBLIC_MAX_DAILY_USERNAME_CALLS_EXCEEDED"},
+	}
+	for _, r := range records {
+		if err := h.Append(r); err != nil {
+			t.Fatalf("error appending: %s", err)
+		}
+	}
+
+	check := func(h *History) {
+		t.Helper()
+
+		r, err := h.Latest("094014298")
+		if err != nil || r.ErrorCode != "RG_WS_PUBLIC_MAX_DAILY_USERNAME_CALLS_EXCEEDED" {
+			t.Errorf("unexpected latest: %+v, error: %v", r, err)
+		}
+
+		r, err = h.AsOf("094014298", day(4))
+		if err != nil || r.Info.Result.PostalAddressNo != "4" {
+			t.Errorf("unexpected state as of day 4: %+v, error: %v", r, err)
+		}
+
+		r, err = h.AsOf("094014298", day(7))
+		if err != nil || r.Info.Result.PostalAddressNo != "6" {
+			t.Errorf("unexpected state as of day 7: %+v, error: %v", r, err)
+		}
+
+		if _, err = h.AsOf("094014298", day(0)); err != ErrNotFound {
+			t.Errorf("expected no state before first lookup, got: %v", err)
+		}
+
+		between, err := h.Between(day(2), day(6))
+		if err != nil || len(between) != 2 || between[0].AFM != "090165560" || !between[1].Time.Equal(day(5)) {
+			t.Errorf("unexpected lookups between: %+v, error: %v", between, err)
+		}
+	}
+
+	check(h)
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(segs) < 2 {
+		t.Errorf("expected several segments, got: %v", segs)
+	}
+
+	// reopen from the saved index
+	if err := h.Close(); err != nil {
+		t.Fatalf("error closing history: %s", err)
+	}
+	h, err = OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error reopening history: %s", err)
+	}
+	check(h)
+	h.Close()
+
+	// rebuild without index, after a crash left a partial line
+	os.Remove(filepath.Join(dir, historyIndexFile))
+	segs, _ = filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	f, _ := os.OpenFile(segs[len(segs)-1], os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString(`{"time":"2022-03-07T12:00:00Z","afm":"0940`)
+	f.Close()
+
+	h, err = OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error rebuilding history: %s", err)
+	}
+	check(h)
+
+	if err := h.Append(HistoryRecord{Time: day(8), AFM: "094014298", Info: info}); err != nil {
+		t.Fatalf("error appending after recovery: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := h.Export(&out); err != nil {
+		t.Fatalf("error exporting: %s", err)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 5 {
+		t.Errorf("unexpected exported lines: %d", lines)
+	}
+	h.Close()
+}
+
+func TestHistoryCompact(t *testing.T) {
+
+	dir := t.TempDir()
+	h, err := OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error opening history: %s", err)
+	}
+	h.SegmentSize = 1024
+
+	info := testSnapshot(t, testVATInfoResponse)
+	for d := 1; d <= 6; d++ {
+		h.Append(HistoryRecord{Time: time.Date(2022, 3, d, 0, 0, 0, 0, time.UTC), AFM: "094014298", Info: info})
+	}
+
+	cut := time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC)
+	if err := h.Compact(cut); err != nil {
+		t.Fatalf("error compacting: %s", err)
+	}
+
+	check := func(h *History) {
+		t.Helper()
+		records, _ := h.Between(time.Time{}, time.Now())
+		if len(records) != 4 || records[0].Time.Day() != 3 {
+			t.Errorf("unexpected records after compaction: %d", len(records))
+		}
+		if r, err := h.AsOf("094014298", cut); err != nil || !r.Time.Equal(cut) {
+			t.Errorf("unexpected state at cut: %v", err)
+		}
+	}
+
+	check(h)
+	if segs, _ := filepath.Glob(filepath.Join(dir, "*.jsonl")); len(segs) != 1 {
+		t.Errorf("segments not merged: %v", segs)
+	}
+
+	h.Close()
+	h, err = OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error reopening history: %s", err)
+	}
+	check(h)
+	h.Close()
+}
+
+func TestHistoryCompactFailure(t *testing.T) {
+
+	dir := t.TempDir()
+	h, err := OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error opening history: %s", err)
+	}
+
+	info := testSnapshot(t, testVATInfoResponse)
+	h.Append(HistoryRecord{Time: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), AFM: "094014298", Info: info})
+
+	// the temporary file cannot be created
+	tmp := h.segmentPath(h.seg+1) + compactSuffix + tmpSuffix
+	if err := os.Mkdir(tmp, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Compact(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatalf("expected compaction to fail")
+	}
+
+	// still usable
+	if err := h.Append(HistoryRecord{Time: time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC), AFM: "094014298", Info: info}); err != nil {
+		t.Fatalf("error appending after a failed compaction: %s", err)
+	}
+	if records, _ := h.Between(time.Time{}, time.Now()); len(records) != 2 {
+		t.Errorf("unexpected records after a failed compaction: %d", len(records))
+	}
+	h.Close()
+
+	// a partial compaction is dropped on open
+	os.Remove(tmp)
+	ioutil.WriteFile(tmp, []byte("{"), 0600)
+	h, err = OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error reopening history: %s", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("partial compaction not removed")
+	}
+	if records, _ := h.Between(time.Time{}, time.Now()); len(records) != 2 {
+		t.Errorf("unexpected records after reopening: %d", len(records))
+	}
+	h.Close()
+}
+
+func TestHistoryCompactInstallFailure(t *testing.T) {
+
+	dir := t.TempDir()
+	h, err := OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error opening history: %s", err)
+	}
+
+	info := testSnapshot(t, testVATInfoResponse)
+	h.Append(HistoryRecord{Time: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), AFM: "094014298", Info: info})
+	h.Append(HistoryRecord{Time: time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), AFM: "094014298", Info: info})
+
+	// the compacted file cannot be renamed, after the old segment is removed
+	target := h.segmentPath(h.seg + 1)
+	if err := os.MkdirAll(filepath.Join(target, "x"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Compact(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatalf("expected compaction to fail")
+	}
+
+	// the index points at removed segments, nothing is answered from it
+	if _, err := h.Latest("094014298"); err == nil || err == ErrNotFound {
+		t.Errorf("expected the history to be unusable, got: %v", err)
+	}
+	if err := h.Append(HistoryRecord{AFM: "094014298"}); err == nil {
+		t.Errorf("expected appending to an unusable history to fail")
+	}
+	h.Close()
+
+	// the compaction is finished on open
+	os.RemoveAll(target)
+	h, err = OpenHistory(dir)
+	if err != nil {
+		t.Fatalf("error reopening history: %s", err)
+	}
+	if records, _ := h.Between(time.Time{}, time.Now()); len(records) != 2 {
+		t.Errorf("unexpected records after reopening: %d", len(records))
+	}
+	h.Close()
+}
+
+func TestClientHistory(t *testing.T) {
+
+	h, err := OpenHistory(t.TempDir())
+	if err != nil {
+		t.Fatalf("error opening history: %s", err)
+	}
+	defer h.Close()
+
+	c := newTestClient(t, respond(testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF")))
+	c.History = h
+
+	if _, err := c.GetVATInfo("", "090165560", "username", "password"); err == nil {
+		t.Fatalf("expected service error")
+	}
+
+	r, err := h.Latest("090165560")
+	if err != nil || r.ErrorCode != "RG_WS_PUBLIC_TAXPAYER_NF" || r.Info != nil {
+		t.Errorf("unexpected recorded lookup: %+v, error: %v", r, err)
+	}
+}
@@ -0,0 +1,93 @@
+package rgwspublic
+
+import "time"
+
+// Hooks are called around every call of a client
+// they can be used for tracing, auditing or tagging calls
+type Hooks interface {
+	// OnRequest is called before a request is sent
+	// calledby and calledfor are empty for a version call
+	OnRequest(operation, calledby, calledfor string)
+
+	// OnResponse is called after a successful call with the raw response
+	// info is nil for version and VIES calls
+	OnResponse(info *VATInfo, raw []byte, d time.Duration)
+
+	// OnError is called when a call fails, for any reason, including invalid
+	// VAT numbers and missing or invalid credentials, which fail before OnRequest
+	OnError(err error)
+}
+
+// HookFuncs implements Hooks with optional functions
+// a nil function is not called
+type HookFuncs struct {
+	Request  func(operation, calledby, calledfor string)
+	Response func(info *VATInfo, raw []byte, d time.Duration)
+	Error    func(err error)
+}
+
+// OnRequest calls Request if set
+func (h HookFuncs) OnRequest(operation, calledby, calledfor string) {
+	if h.Request != nil {
+		h.Request(operation, calledby, calledfor)
+	}
+}
+
+// OnResponse calls Response if set
+func (h HookFuncs) OnResponse(info *VATInfo, raw []byte, d time.Duration) {
+	if h.Response != nil {
+		h.Response(info, raw, d)
+	}
+}
+
+// OnError calls Error if set
+func (h HookFuncs) OnError(err error) {
+	if h.Error != nil {
+		h.Error(err)
+	}
+}
+
+// MultiHooks calls each of the given hooks in order
+func MultiHooks(hooks ...Hooks) Hooks {
+	return multiHooks(hooks)
+}
+
+type multiHooks []Hooks
+
+func (m multiHooks) OnRequest(operation, calledby, calledfor string) {
+	for _, h := range m {
+		h.OnRequest(operation, calledby, calledfor)
+	}
+}
+
+func (m multiHooks) OnResponse(info *VATInfo, raw []byte, d time.Duration) {
+	for _, h := range m {
+		h.OnResponse(info, raw, d)
+	}
+}
+
+func (m multiHooks) OnError(err error) {
+	for _, h := range m {
+		h.OnError(err)
+	}
+}
+
+func (c *Client) onRequest(operation, calledby, calledfor string) {
+	if c.Hooks != nil {
+		c.Hooks.OnRequest(operation, calledby, calledfor)
+	}
+}
+
+func (c *Client) onResponse(info *VATInfo, raw []byte, d time.Duration) {
+	if c.Hooks != nil {
+		c.Hooks.OnResponse(info, raw, d)
+	}
+}
+
+// onError passes err to hooks and returns it
+func (c *Client) onError(err error) error {
+	if c.Hooks != nil {
+		c.Hooks.OnError(err)
+	}
+	return err
+}
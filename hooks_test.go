@@ -0,0 +1,171 @@
+package rgwspublic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+
+	c := newTestClient(t, respond(testVATInfoResponse))
+
+	var events []string
+	c.Hooks = MultiHooks(
+		HookFuncs{
+			Request: func(operation, calledby, calledfor string) {
+				events = append(events, "request:"+operation+":"+calledfor)
+			},
+			Response: func(info *VATInfo, raw []byte, d time.Duration) {
+				if !strings.Contains(string(raw), "<call_seq_id>46447592</call_seq_id>") {
+					t.Errorf("raw response missing call_seq_id")
+				}
+				events = append(events, "response:"+info.Result.AFM)
+			},
+		},
+		HookFuncs{
+			Error: func(err error) {
+				events = append(events, "error")
+			},
+		},
+	)
+
+	if _, err := c.GetVATInfo("", "094014298", "username", "password"); err != nil {
+		t.Fatalf("error getting VAT info: %s", err)
+	}
+
+	c.Endpoint = "http://127.0.0.1:0"
+	if _, err := c.Version(); err == nil {
+		t.Fatalf("expected error calling a closed endpoint")
+	}
+
+	wanted := []string{"request:get_vat_info:094014298", "response:094014298", "request:version:", "error"}
+	if strings.Join(events, ",") != strings.Join(wanted, ",") {
+		t.Errorf("unexpected events, got: %v, wanted: %v", events, wanted)
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				r.Header.Set("X-Tenant", name)
+				return next.RoundTrip(r)
+			})
+		}
+	}
+
+	var tenant string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		tenant = r.Header.Get("X-Tenant")
+		respond(testVersionResponse)(w, r)
+	})
+	c.Middleware = []Middleware{tag("outer"), tag("inner")}
+
+	if _, err := c.Version(); err != nil {
+		t.Fatalf("error getting version: %s", err)
+	}
+
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("unexpected order: %v", order)
+	}
+	if tenant != "inner" {
+		t.Errorf("unexpected tenant header, got: %s", tenant)
+	}
+}
+
+func TestMiddlewareRetry(t *testing.T) {
+
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		respond(testVersionResponse)(w, r)
+	})
+	c.Middleware = []Middleware{Retry(2, time.Millisecond)}
+
+	if _, err := c.Version(); err != nil {
+		t.Fatalf("error getting version after retries: %s", err)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected calls, got: %d, wanted: 3", calls)
+	}
+}
+
+func TestMiddlewareRetryFault(t *testing.T) {
+
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(testFaultResponse))
+	})
+	c.Middleware = []Middleware{Retry(3, time.Millisecond)}
+	c.Metrics = NewMetrics()
+
+	if _, err := c.Version(); err == nil {
+		t.Fatalf("expected an error for a fault")
+	}
+	if calls != 1 {
+		t.Errorf("fault retried, %d calls", calls)
+	}
+
+	// the body read looking for the fault is still there
+	if c.Metrics.Calls(OpVersion, OutcomeFault, "env:Receiver") != 1 {
+		t.Errorf("fault body lost")
+	}
+}
+
+func TestMiddlewareRetryCancel(t *testing.T) {
+
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	rt := Chain(c.HTTPClient.Transport, Retry(3, time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", c.Endpoint, nil)
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := rt.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the request to be cancelled, got: %v", err)
+	}
+	if calls != 1 || time.Since(start) > time.Minute {
+		t.Errorf("kept retrying after cancel: %d calls", calls)
+	}
+}
+
+func TestHooksEarlyErrors(t *testing.T) {
+
+	var errs []error
+	c := newTestClient(t, respond(testVATInfoResponse))
+	c.Hooks = HookFuncs{Error: func(err error) { errs = append(errs, err) }}
+
+	c.GetVATInfo("", "123", "username", "password")
+	c.Lookup("", "094014298")
+
+	perr := errors.New("vault sealed")
+	c.Credentials = failingCredentials{perr}
+	c.Lookup("", "094014298")
+
+	if len(errs) != 3 || !errors.Is(errs[0], ErrInvalidVAT) || errs[1] != ErrNoCredentials || !errors.Is(errs[2], perr) {
+		t.Errorf("unexpected errors passed to hooks: %v", errs)
+	}
+}
+
+type failingCredentials struct{ err error }
+
+func (f failingCredentials) Credentials() (Credentials, error) { return Credentials{}, f.err }
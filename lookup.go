@@ -0,0 +1,180 @@
+package rgwspublic
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// registries a Party can come from
+const (
+	SourceGSIS = "gsis"
+	SourceVIES = "vies"
+)
+
+// ErrNoLookup is returned by a router with no provider for a country
+var ErrNoLookup = errors.New("no lookup configured for country")
+
+// Party is the registry record of a tax id, whichever registry answered
+type Party struct {
+	Country string    `json:"country"` // EL for Greece, as in VIES
+	TaxID   string    `json:"tax_id"`  // without the country prefix
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	Active  bool      `json:"active"`
+	Source  string    `json:"source"`
+	Time    time.Time `json:"time"`
+}
+
+// TaxIDLookup finds the registry record of a tax id
+// id is a number with its country prefix, e.g. EL094014298 or DE123456789
+// a number without prefix is greek
+type TaxIDLookup interface {
+	LookupTaxID(id string) (*Party, error)
+}
+
+// GSISLookup looks up greek numbers with the credentials of Client
+type GSISLookup struct {
+	Client *Client
+}
+
+// LookupTaxID looks up a greek number in the GSIS registry
+// numbers failing ValidateVAT are rejected without a call
+func (g GSISLookup) LookupTaxID(id string) (*Party, error) {
+
+	number, err := validateAFM(id)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := g.Client.Lookup("", number)
+	if err != nil {
+		return nil, err
+	}
+
+	r := i.Result
+	var address []string
+	for _, s := range []string{r.PostalAddress + " " + r.PostalAddressNo, r.PostalZipCode + " " + r.PostalAreaDescription} {
+		if s = squash(s); s != "" {
+			address = append(address, s)
+		}
+	}
+
+	return &Party{
+		Country: "EL",
+		TaxID:   squash(r.AFM),
+		Name:    squash(r.Onomasia),
+		Address: strings.Join(address, ", "),
+		Active:  squash(r.DeactivationFlag) == "1" && squash(r.StopDate) == "",
+		Source:  SourceGSIS,
+		Time:    time.Now(),
+	}, nil
+}
+
+// VIESLookup looks up EU numbers with the VIES service of Client
+type VIESLookup struct {
+	Client *Client
+}
+
+// LookupTaxID checks a number in VIES, an invalid number is an inactive party
+// numbers failing ValidateVAT are rejected without a call
+func (v VIESLookup) LookupTaxID(id string) (*Party, error) {
+
+	country, number, err := ValidateVAT(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := v.Client.CheckVat(country, number)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Party{
+		Country: res.CountryCode,
+		TaxID:   res.VATNumber,
+		Name:    res.Name,
+		Address: squash(res.Address),
+		Active:  res.Valid,
+		Source:  SourceVIES,
+		Time:    time.Now(),
+	}, nil
+}
+
+// TaxIDRouter sends greek numbers to GSIS and other EU numbers to VIES
+// greek numbers go to VIES too when GSIS has no usable credentials left
+type TaxIDRouter struct {
+	GSIS TaxIDLookup
+	VIES TaxIDLookup
+}
+
+// NewTaxIDRouter returns a router using the GSIS and VIES services of c
+func NewTaxIDRouter(c *Client) *TaxIDRouter {
+	return &TaxIDRouter{GSIS: GSISLookup{Client: c}, VIES: VIESLookup{Client: c}}
+}
+
+// LookupTaxID routes id by its country prefix
+func (r *TaxIDRouter) LookupTaxID(id string) (*Party, error) {
+
+	country, _ := splitTaxID(id)
+	if country != "EL" {
+		if r.VIES == nil {
+			return nil, ErrNoLookup
+		}
+		return r.VIES.LookupTaxID(id)
+	}
+
+	if r.GSIS == nil {
+		if r.VIES == nil {
+			return nil, ErrNoLookup
+		}
+		return r.VIES.LookupTaxID(id)
+	}
+
+	p, err := r.GSIS.LookupTaxID(id)
+	if err != nil && r.VIES != nil && credentialsUnavailable(err) {
+		return r.VIES.LookupTaxID(id)
+	}
+
+	return p, err
+}
+
+// service codes meaning the credentials can't be used for now
+var unavailableCodes = map[string]bool{
+	"RG_WS_PUBLIC_MONTHLY_LIMIT_EXCEEDED":           true,
+	"RG_WS_PUBLIC_FAILURES_TOLERATED_EXCEEDED":      true,
+	"RG_WS_PUBLIC_TOKEN_USERNAME_NOT_ACTIVE":        true,
+	"RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED": true,
+}
+
+// credentialsUnavailable reports whether err means GSIS credentials are missing or exhausted
+func credentialsUnavailable(err error) bool {
+
+	if errors.Is(err, ErrNoCredentials) || errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrPoolExhausted) {
+		return true
+	}
+
+	var serr *ServiceError
+	if errors.As(err, &serr) {
+		return poolExcludeCodes[serr.Code] || unavailableCodes[serr.Code]
+	}
+
+	return false
+}
+
+// splitTaxID returns the country prefix and number of a tax id
+// GR is returned as EL, a number without prefix is greek
+func splitTaxID(id string) (string, string) {
+
+	id = strings.ToUpper(strings.Join(strings.Fields(id), ""))
+	if len(id) < 2 || id[0] < 'A' || id[0] > 'Z' || id[1] < 'A' || id[1] > 'Z' {
+		return "EL", id
+	}
+
+	country := id[:2]
+	if country == "GR" {
+		country = "EL"
+	}
+
+	return country, id[2:]
+}
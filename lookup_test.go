@@ -0,0 +1,102 @@
+package rgwspublic
+
+import (
+	"errors"
+	"testing"
+)
+
+// testLookup answers with a party of its source, or err
+type testLookup struct {
+	source string
+	err    error
+	ids    []string
+}
+
+func (l *testLookup) LookupTaxID(id string) (*Party, error) {
+	l.ids = append(l.ids, id)
+	if l.err != nil {
+		return nil, l.err
+	}
+	return &Party{Source: l.source}, nil
+}
+
+func TestGSISLookup(t *testing.T) {
+
+	c := newTestClient(t, respond(testVATInfoResponse))
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+
+	p, err := GSISLookup{Client: c}.LookupTaxID("EL 094014298")
+	if err != nil {
+		t.Fatalf("error looking up: %s", err)
+	}
+
+	if p.Country != "EL" || p.TaxID != "094014298" || p.Name != "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ" ||
+		p.Address != "ΑΜΕΡΙΚΗΣ 4, 10564 ΑΘΗΝΑ" || !p.Active || p.Source != SourceGSIS || p.Time.IsZero() {
+		t.Errorf("unexpected party: %+v", p)
+	}
+}
+
+func TestVIESLookup(t *testing.T) {
+
+	c := newTestVIESClient(t, respond(testCheckVatResponse))
+
+	if _, err := (VIESLookup{Client: c}).LookupTaxID("DE123456789"); !errors.Is(err, ErrVATChecksum) {
+		t.Errorf("invalid number should be rejected before the call, got: %v", err)
+	}
+
+	p, err := VIESLookup{Client: c}.LookupTaxID("DE136695976")
+	if err != nil {
+		t.Fatalf("error looking up: %s", err)
+	}
+
+	if p.Country != "DE" || p.TaxID != "123456788" || !p.Active || p.Source != SourceVIES {
+		t.Errorf("unexpected party: %+v", p)
+	}
+}
+
+func TestTaxIDRouter(t *testing.T) {
+
+	tests := []struct {
+		id      string
+		gsisErr error
+		source  string
+		err     error
+	}{
+		{"EL094014298", nil, SourceGSIS, nil},
+		{"GR094014298", nil, SourceGSIS, nil},
+		{"094014298", nil, SourceGSIS, nil},
+		{"DE123456789", nil, SourceVIES, nil},
+		{"EL094014298", ErrNoCredentials, SourceVIES, nil},
+		{"EL094014298", ErrPoolExhausted, SourceVIES, nil},
+		{"EL094014298", &ServiceError{Code: "RG_WS_PUBLIC_MAX_DAILY_USERNAME_CALLS_EXCEEDED"}, SourceVIES, nil},
+		{"EL094014298", &ServiceError{Code: "RG_WS_PUBLIC_TAXPAYER_NF"}, "", nil},
+		{"EL094014298", ErrInvalidVAT, "", ErrInvalidVAT},
+	}
+
+	for _, tt := range tests {
+
+		gsis := &testLookup{source: SourceGSIS, err: tt.gsisErr}
+		vies := &testLookup{source: SourceVIES}
+		r := &TaxIDRouter{GSIS: gsis, VIES: vies}
+
+		p, err := r.LookupTaxID(tt.id)
+		if tt.source == "" {
+			if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("%s with %v: expected an error, got: %v", tt.id, tt.gsisErr, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s with %v: unexpected error: %s", tt.id, tt.gsisErr, err)
+			continue
+		}
+		if p.Source != tt.source {
+			t.Errorf("%s with %v: answered by %s, wanted: %s", tt.id, tt.gsisErr, p.Source, tt.source)
+		}
+	}
+
+	if _, err := (&TaxIDRouter{GSIS: &testLookup{}}).LookupTaxID("DE123456789"); err != ErrNoLookup {
+		t.Errorf("expected ErrNoLookup, got: %v", err)
+	}
+}
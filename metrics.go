@@ -0,0 +1,259 @@
+package rgwspublic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// call outcomes, used to label metrics
+const (
+	OutcomeOK       = "ok"       // service returned a result
+	OutcomeRejected = "rejected" // service returned an RG_WS_PUBLIC_* error code
+	OutcomeFault    = "fault"    // service returned a soap fault
+	OutcomeError    = "error"    // transport, http or parsing error
+)
+
+// DefaultBuckets are the latency histogram buckets in seconds
+var DefaultBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type callKey struct {
+	operation, outcome, code string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Metrics is a small registry of counters and histograms for service calls
+// it renders itself in the prometheus text exposition format
+// a nil *Metrics is valid and records nothing, a zero Metrics is ready to use with DefaultBuckets
+type Metrics struct {
+	mu        sync.Mutex
+	buckets   []float64
+	calls     map[callKey]uint64
+	latency   map[string]*histogram
+	cacheHits map[string]uint64
+	quota     *float64
+}
+
+// NewMetrics returns an empty registry using DefaultBuckets
+func NewMetrics() *Metrics {
+	return &Metrics{
+		buckets:   DefaultBuckets,
+		calls:     map[callKey]uint64{},
+		latency:   map[string]*histogram{},
+		cacheHits: map[string]uint64{},
+	}
+}
+
+// init makes the maps of a zero Metrics, m.mu must be held
+func (m *Metrics) init() {
+	if m.calls != nil {
+		return
+	}
+	if m.buckets == nil {
+		m.buckets = DefaultBuckets
+	}
+	m.calls = map[callKey]uint64{}
+	m.latency = map[string]*histogram{}
+	m.cacheHits = map[string]uint64{}
+}
+
+// ObserveCall counts a call and records its latency
+// code is the RG_WS_PUBLIC_* or fault code returned, if any
+func (m *Metrics) ObserveCall(operation, outcome, code string, d time.Duration) {
+
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	m.calls[callKey{operation, outcome, code}]++
+
+	h, ok := m.latency[operation]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[operation] = h
+	}
+
+	s := d.Seconds()
+	for i, b := range m.buckets {
+		if s <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+// ObserveCacheHit counts a call answered without reaching the service,
+// for middleware or wrappers caching lookups
+func (m *Metrics) ObserveCacheHit(operation string) {
+
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.init()
+	m.cacheHits[operation]++
+	m.mu.Unlock()
+}
+
+// SetQuotaRemaining sets the number of calls left in the current quota
+// a Monitor with a DailyBudget sets it on every lookup it makes
+func (m *Metrics) SetQuotaRemaining(n int64) {
+
+	if m == nil {
+		return
+	}
+
+	v := float64(n)
+	m.mu.Lock()
+	m.quota = &v
+	m.mu.Unlock()
+}
+
+// Calls returns the number of calls recorded for an operation, outcome and code
+func (m *Metrics) Calls(operation, outcome, code string) uint64 {
+
+	if m == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[callKey{operation, outcome, code}]
+}
+
+// WriteTo renders all metrics in the prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+
+	if m != nil {
+		m.mu.Lock()
+		m.write(cw)
+		m.mu.Unlock()
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+// ServeHTTP exposes the registry, so it can be mounted at /metrics
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func (m *Metrics) write(w *countWriter) {
+
+	w.printf("# HELP rgwspublic_calls_total Calls to the GSIS service by operation, outcome and error code.\n")
+	w.printf("# TYPE rgwspublic_calls_total counter\n")
+	keys := make([]callKey, 0, len(m.calls))
+	for k := range m.calls {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		if a.outcome != b.outcome {
+			return a.outcome < b.outcome
+		}
+		return a.code < b.code
+	})
+	for _, k := range keys {
+		w.printf("rgwspublic_calls_total{operation=%s,outcome=%s,code=%s} %d\n",
+			quoteLabel(k.operation), quoteLabel(k.outcome), quoteLabel(k.code), m.calls[k])
+	}
+
+	w.printf("# HELP rgwspublic_request_duration_seconds Latency of calls to the GSIS service.\n")
+	w.printf("# TYPE rgwspublic_request_duration_seconds histogram\n")
+	for _, op := range sortedOperations(m.latency) {
+		h := m.latency[op]
+		var cum uint64
+		for i, b := range m.buckets {
+			cum += h.counts[i]
+			w.printf("rgwspublic_request_duration_seconds_bucket{operation=%s,le=\"%s\"} %d\n",
+				quoteLabel(op), formatFloat(b), cum)
+		}
+		w.printf("rgwspublic_request_duration_seconds_bucket{operation=%s,le=\"+Inf\"} %d\n", quoteLabel(op), h.count)
+		w.printf("rgwspublic_request_duration_seconds_sum{operation=%s} %s\n", quoteLabel(op), formatFloat(h.sum))
+		w.printf("rgwspublic_request_duration_seconds_count{operation=%s} %d\n", quoteLabel(op), h.count)
+	}
+
+	w.printf("# HELP rgwspublic_cache_hits_total Calls answered from cache.\n")
+	w.printf("# TYPE rgwspublic_cache_hits_total counter\n")
+	for _, op := range sortedCounters(m.cacheHits) {
+		w.printf("rgwspublic_cache_hits_total{operation=%s} %d\n", quoteLabel(op), m.cacheHits[op])
+	}
+
+	if m.quota != nil {
+		w.printf("# HELP rgwspublic_quota_remaining Calls left in the current quota.\n")
+		w.printf("# TYPE rgwspublic_quota_remaining gauge\n")
+		w.printf("rgwspublic_quota_remaining %s\n", formatFloat(*m.quota))
+	}
+}
+
+func sortedOperations(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedCounters(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// quoteLabel escapes a label value as the exposition format expects
+func quoteLabel(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countWriter keeps the first error and number of bytes written
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) printf(format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(c.w, format, args...)
+	c.n += int64(n)
+	c.err = err
+}
@@ -0,0 +1,117 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExposition(t *testing.T) {
+
+	m := NewMetrics()
+	m.ObserveCall(OpGetVATInfo, OutcomeOK, "", 200*time.Millisecond)
+	m.ObserveCall(OpGetVATInfo, OutcomeRejected, "RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED", 2*time.Second)
+	m.ObserveCall(OpVersion, OutcomeError, "", 40*time.Millisecond)
+	m.SetQuotaRemaining(4200)
+	m.ObserveCacheHit(OpGetVATInfo)
+	m.ObserveCacheHit(OpGetVATInfo)
+
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("error writing metrics: %s", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("unexpected byte count, got: %d, wanted: %d", n, buf.Len())
+	}
+
+	out := buf.String()
+	t.Log(out)
+
+	wanted := []string{
+		`# TYPE rgwspublic_calls_total counter`,
+		`rgwspublic_calls_total{operation="get_vat_info",outcome="ok",code=""} 1`,
+		`rgwspublic_calls_total{operation="get_vat_info",outcome="rejected",code="RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED"} 1`,
+		`rgwspublic_calls_total{operation="version",outcome="error",code=""} 1`,
+		`rgwspublic_request_duration_seconds_bucket{operation="get_vat_info",le="0.1"} 0`,
+		`rgwspublic_request_duration_seconds_bucket{operation="get_vat_info",le="0.25"} 1`,
+		`rgwspublic_request_duration_seconds_bucket{operation="get_vat_info",le="2.5"} 2`,
+		`rgwspublic_request_duration_seconds_bucket{operation="get_vat_info",le="+Inf"} 2`,
+		`rgwspublic_request_duration_seconds_sum{operation="get_vat_info"} 2.2`,
+		`rgwspublic_request_duration_seconds_count{operation="version"} 1`,
+		`# TYPE rgwspublic_cache_hits_total counter`,
+		`rgwspublic_cache_hits_total{operation="get_vat_info"} 2`,
+		`rgwspublic_quota_remaining 4200`,
+	}
+	for _, w := range wanted {
+		if !strings.Contains(out, w+"\n") {
+			t.Errorf("missing line: %s", w)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+
+	m := NewMetrics()
+	m.ObserveCall(OpVersion, OutcomeFault, `env:"Receiver"`, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type: %s", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `code="env:\"Receiver\""`) {
+		t.Errorf("label not escaped: %s", rec.Body.String())
+	}
+}
+
+func TestMetricsZero(t *testing.T) {
+
+	m := &Metrics{}
+	m.ObserveCall(OpVersion, OutcomeOK, "", 200*time.Millisecond)
+	m.ObserveCacheHit(OpVersion)
+
+	if m.Calls(OpVersion, OutcomeOK, "") != 1 {
+		t.Errorf("call not counted")
+	}
+
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `rgwspublic_request_duration_seconds_bucket{operation="version",le="0.25"} 1`) {
+		t.Errorf("default buckets not used:\n%s", buf.String())
+	}
+}
+
+func TestMetricsNil(t *testing.T) {
+
+	var m *Metrics
+	m.ObserveCall(OpVersion, OutcomeOK, "", time.Second)
+	m.ObserveCacheHit(OpVersion)
+	m.SetQuotaRemaining(1)
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Errorf("error writing nil metrics: %s", err)
+	}
+}
+
+func TestMetricsFault(t *testing.T) {
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(testFaultResponse))
+	})
+	c.Metrics = NewMetrics()
+
+	if _, err := c.Version(); err == nil {
+		t.Fatalf("expected an error for a fault")
+	}
+	if n := c.Metrics.Calls(OpVersion, OutcomeFault, "env:Receiver"); n != 1 {
+		t.Errorf("fault not recorded, got %d", n)
+	}
+}
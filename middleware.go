@@ -0,0 +1,118 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// RoundTripperFunc is a function implementing http.RoundTripper
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(r)
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Middleware wraps a transport with extra behavior
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Chain wraps rt with the given middleware, first one is outermost
+// a nil rt means http.DefaultTransport
+func Chain(rt http.RoundTripper, mw ...Middleware) http.RoundTripper {
+
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	for i := len(mw) - 1; i >= 0; i-- {
+		rt = mw[i](rt)
+	}
+
+	return rt
+}
+
+// Retry returns a middleware that retries a request up to n more times
+// on transport errors and 5xx responses, waiting backoff, doubled each time
+// soap faults are answers, not outages, so 5xx responses with a fault are not retried
+// it stops waiting when the request's context is done
+func Retry(n int, backoff time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+
+			resp, err := next.RoundTrip(r)
+			for i := 0; i < n && retryable(resp, err); i++ {
+
+				// the body was consumed, so get a fresh one or give up
+				if r.Body != nil && r.GetBody == nil {
+					break
+				}
+				if r.GetBody != nil {
+					body, berr := r.GetBody()
+					if berr != nil {
+						break
+					}
+					r = r.Clone(r.Context())
+					r.Body = body
+				}
+
+				if resp != nil {
+					resp.Body.Close()
+				}
+
+				t := time.NewTimer(backoff << uint(i))
+				select {
+				case <-r.Context().Done():
+					t.Stop()
+					return nil, r.Context().Err()
+				case <-t.C:
+				}
+
+				resp, err = next.RoundTrip(r)
+			}
+
+			return resp, err
+		})
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 && !isFault(resp)
+}
+
+// faultPeek is how much of a response is read looking for a soap fault
+const faultPeek = 64 << 10
+
+// isFault reports whether an xml response holds a soap fault
+// the body read is put back, so the response can still be read whole
+func isFault(resp *http.Response) bool {
+
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" || !isXMLContentType(ct) {
+		return false
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, faultPeek))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.CharsetReader = charsetReader
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "Fault" {
+			return true
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package rgwspublic
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// MyDATANamespace is the namespace of myDATA invoice documents
+const MyDATANamespace = "http://www.aade.gr/myDATA/invoice/v1.0"
+
+// maximum characters of the myDATA AddressType fields
+const (
+	MyDATAStreetLength     = 150
+	MyDATANumberLength     = 15
+	MyDATAPostalCodeLength = 15
+	MyDATACityLength       = 150
+)
+
+// errors returned by ValidateMyDATA
+var (
+	ErrMyDATAInvalidAFM    = errors.New("afm is not a 9 digit greek vat number")
+	ErrMyDATADeactivated   = errors.New("afm is deactivated")
+	ErrMyDATAStopped       = errors.New("business has stopped")
+	ErrMyDATANoPostalCode  = errors.New("postal code is missing")
+	ErrMyDATANoCity        = errors.New("city is missing")
+	ErrMyDATAFieldTooLong  = errors.New("address field exceeds the myDATA length limit")
+	ErrMyDATARegistryError = errors.New("record is a registry error")
+)
+
+// MyDATACounterpart is the myDATA PartyType of an invoice counterpart,
+// elements in schema order
+type MyDATACounterpart struct {
+	XMLName   xml.Name       `xml:"counterpart"`
+	VATNumber string         `xml:"vatNumber"`
+	Country   string         `xml:"country"`
+	Branch    int            `xml:"branch"`
+	Name      string         `xml:"name,omitempty"`
+	Address   *MyDATAAddress `xml:"address,omitempty"`
+}
+
+// MyDATAAddress is the myDATA AddressType
+type MyDATAAddress struct {
+	Street     string `xml:"street,omitempty"`
+	Number     string `xml:"number,omitempty"`
+	PostalCode string `xml:"postalCode"`
+	City       string `xml:"city"`
+}
+
+// NewMyDATACounterpart fills a counterpart from a record, branch 0 is the headquarters
+// the country is GR, so the name is left out as myDATA does not accept it for greek counterparts,
+// address fields are cut to their length limits
+func NewMyDATACounterpart(i *VATInfo, branch int) *MyDATACounterpart {
+
+	r := i.Result
+	return &MyDATACounterpart{
+		VATNumber: squash(r.AFM),
+		Country:   "GR",
+		Branch:    branch,
+		Address: &MyDATAAddress{
+			Street:     truncate(squash(r.PostalAddress), MyDATAStreetLength),
+			Number:     truncate(squash(r.PostalAddressNo), MyDATANumberLength),
+			PostalCode: truncate(squash(r.PostalZipCode), MyDATAPostalCodeLength),
+			City:       truncate(squash(r.PostalAreaDescription), MyDATACityLength),
+		},
+	}
+}
+
+// ValidateMyDATA returns the reasons myDATA would reject the record as a counterpart,
+// or nil if there are none
+func ValidateMyDATA(i *VATInfo) []error {
+
+	var errs []error
+	if i.error() != nil {
+		return append(errs, ErrMyDATARegistryError)
+	}
+
+	r := i.Result
+	afm := squash(r.AFM)
+	if len(afm) != 9 || strings.Trim(afm, "0123456789") != "" {
+		errs = append(errs, ErrMyDATAInvalidAFM)
+	}
+	if squash(r.DeactivationFlag) == "2" {
+		errs = append(errs, ErrMyDATADeactivated)
+	}
+	if squash(r.StopDate) != "" {
+		errs = append(errs, ErrMyDATAStopped)
+	}
+	if squash(r.PostalZipCode) == "" {
+		errs = append(errs, ErrMyDATANoPostalCode)
+	}
+	if squash(r.PostalAreaDescription) == "" {
+		errs = append(errs, ErrMyDATANoCity)
+	}
+
+	fields := []struct {
+		value string
+		limit int
+	}{
+		{r.PostalAddress, MyDATAStreetLength},
+		{r.PostalAddressNo, MyDATANumberLength},
+		{r.PostalZipCode, MyDATAPostalCodeLength},
+		{r.PostalAreaDescription, MyDATACityLength},
+	}
+	for _, f := range fields {
+		if utf8.RuneCountInString(squash(f.value)) > f.limit {
+			errs = append(errs, ErrMyDATAFieldTooLong)
+			break
+		}
+	}
+
+	return errs
+}
+
+// String returns the xml of the counterpart
+func (c *MyDATACounterpart) String() string {
+
+	b, err := xml.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
+// truncate cuts s to n characters
+func truncate(s string, n int) string {
+
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,65 @@
+package rgwspublic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMyDATACounterpart(t *testing.T) {
+
+	i := testSnapshot(t, testVATInfoResponse)
+	i.Result.PostalAddress = strings.Repeat("Α", MyDATAStreetLength+10)
+
+	c := NewMyDATACounterpart(i, 0)
+	out := c.String()
+
+	wanted := []string{
+		"<vatNumber>094014298</vatNumber>",
+		"<country>GR</country>",
+		"<branch>0</branch>",
+		"<number>4</number>",
+		"<postalCode>10564</postalCode>",
+		"<city>ΑΘΗΝΑ</city>",
+		"<street>" + strings.Repeat("Α", MyDATAStreetLength) + "</street>",
+	}
+	for _, w := range wanted {
+		if !strings.Contains(out, w) {
+			t.Errorf("missing %s", w)
+		}
+	}
+
+	if strings.Contains(out, "<name>") {
+		t.Errorf("name should not be sent for a greek counterpart")
+	}
+
+	errs := ValidateMyDATA(i)
+	if len(errs) != 1 || errs[0] != ErrMyDATAFieldTooLong {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
+
+func TestValidateMyDATA(t *testing.T) {
+
+	if errs := ValidateMyDATA(testSnapshot(t, testVATInfoResponse)); errs != nil {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+
+	i := testSnapshot(t, testChangedResponse)
+	i.Result.PostalZipCode = " "
+
+	errs := ValidateMyDATA(i)
+	wanted := []error{ErrMyDATADeactivated, ErrMyDATAStopped, ErrMyDATANoPostalCode}
+	if len(errs) != len(wanted) {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	for k := range wanted {
+		if errs[k] != wanted[k] {
+			t.Errorf("unexpected error %d, got: %v, wanted: %v", k, errs[k], wanted[k])
+		}
+	}
+
+	e := testSnapshot(t, testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF"))
+	if errs := ValidateMyDATA(e); len(errs) != 1 || errs[0] != ErrMyDATARegistryError {
+		t.Errorf("unexpected validation errors for a registry error: %v", errs)
+	}
+}
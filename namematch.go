@@ -0,0 +1,282 @@
+package rgwspublic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultNameThreshold is the score from which names match
+const DefaultNameThreshold = 0.85
+
+// legal forms, as normalized token sequences, longest first
+var legalForms = [][]string{
+	{"ΑΝΩΝΥΜΗ", "ΕΜΠΟΡΙΚΗ", "ΚΑΙ", "ΒΙΟΜΗΧΑΝΙΚΗ", "ΕΤΑΙΡΕΙΑ"},
+	{"ΙΔΙΩΤΙΚΗ", "ΚΕΦΑΛΑΙΟΥΧΙΚΗ", "ΕΤΑΙΡΕΙΑ"},
+	{"ΕΤΑΙΡΕΙΑ", "ΠΕΡΙΟΡΙΣΜΕΝΗΣ", "ΕΥΘΥΝΗΣ"},
+	{"ΑΝΩΝΥΜΗ", "ΕΤΑΙΡΕΙΑ"},
+	{"ΟΜΟΡΡΥΘΜΗ", "ΕΤΑΙΡΕΙΑ"},
+	{"ΕΤΕΡΟΡΡΥΘΜΗ", "ΕΤΑΙΡΕΙΑ"},
+	{"ΚΑΙ", "ΣΙΑ"},
+	{"ΑΕΒΕ"}, {"ΑΒΕΕ"}, {"ΑΕΕ"}, {"ΑΕ"}, {"ΜΕΠΕ"}, {"ΕΠΕ"}, {"ΜΙΚΕ"}, {"ΙΚΕ"},
+	{"ΟΕ"}, {"ΕΕ"}, {"ΣΙΑ"},
+	{"SA"}, {"LTD"}, {"LLC"}, {"GMBH"}, {"PLC"}, {"INC"}, {"IKE"}, {"EPE"}, {"AE"}, {"OE"}, {"EE"},
+}
+
+// NameMatch is the outcome of comparing a name with the registry
+type NameMatch struct {
+	Input       string   `json:"input"`
+	Field       string   `json:"field"` // onomasia or commercial_title, whichever scored best
+	Registry    string   `json:"registry"`
+	Score       float64  `json:"score"`
+	TokenScore  float64  `json:"token_score"`
+	EditScore   float64  `json:"edit_score"`
+	Match       bool     `json:"match"`
+	Explanation []string `json:"explanation"`
+}
+
+// NameMatcher compares names as people type them with registry names
+// ignoring case, accents, final sigma, look-alike latin letters, punctuation and legal forms
+type NameMatcher struct {
+	// Threshold is the score from which names match, DefaultNameThreshold if 0
+	Threshold float64
+}
+
+// MatchName compares input with the names of r using DefaultNameThreshold
+func MatchName(input string, r VATResult) NameMatch {
+	return NameMatcher{}.Match(input, r)
+}
+
+// Match compares input with Onomasia and CommercialTitle of r and returns the best match
+// the score is the highest of a token score, how many words match allowing typos,
+// and an edit score, the edit distance of the whole names
+func (m NameMatcher) Match(input string, r VATResult) NameMatch {
+
+	threshold := m.Threshold
+	if threshold == 0 {
+		threshold = DefaultNameThreshold
+	}
+
+	best := NameMatch{Input: input}
+	for _, f := range [][2]string{{"onomasia", r.Onomasia}, {"commercial_title", r.CommercialTitle}} {
+		if squash(f[1]) == "" {
+			continue
+		}
+		nm := compareNames(input, f[1])
+		if best.Field == "" || nm.Score > best.Score {
+			nm.Field = f[0]
+			best = nm
+		}
+	}
+
+	if best.Field == "" {
+		best.Explanation = append(best.Explanation, "registry has no name")
+		return best
+	}
+
+	best.Match = best.Score >= threshold
+	verdict := "below"
+	if best.Match {
+		verdict = "reaches"
+	}
+	best.Explanation = append(best.Explanation,
+		fmt.Sprintf("best is %s, score %.2f %s threshold %.2f", best.Field, best.Score, verdict, threshold))
+
+	return best
+}
+
+func compareNames(input, registry string) NameMatch {
+
+	nm := NameMatch{Input: input, Registry: registry}
+
+	a, aforms := nameTokens(input)
+	b, bforms := nameTokens(registry)
+
+	// compare in latin letters when either side isn't greek
+	if isLatin(a) != isLatin(b) {
+		a, b = transliterateTokens(a), transliterateTokens(b)
+		nm.Explanation = append(nm.Explanation, "compared in latin letters")
+	}
+
+	nm.Explanation = append(nm.Explanation, fmt.Sprintf("normalized %q and %q", strings.Join(a, " "), strings.Join(b, " ")))
+	if len(aforms)+len(bforms) > 0 {
+		nm.Explanation = append(nm.Explanation, "ignored legal forms "+strings.Join(append(aforms, bforms...), ", "))
+	}
+
+	nm.TokenScore = tokenScore(a, b)
+	nm.EditScore = similarity(strings.Join(a, " "), strings.Join(b, " "))
+
+	// word order doesn't matter, compare sorted too
+	sa, sb := append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	if s := similarity(strings.Join(sa, " "), strings.Join(sb, " ")); s > nm.EditScore {
+		nm.EditScore = s
+	}
+
+	nm.Score = nm.TokenScore
+	if nm.EditScore > nm.Score {
+		nm.Score = nm.EditScore
+	}
+	nm.Explanation = append(nm.Explanation, fmt.Sprintf("token score %.2f, edit score %.2f", nm.TokenScore, nm.EditScore))
+
+	return nm
+}
+
+// NormalizeName writes a name in capitals without accents and punctuation,
+// with Α.Ε. as ΑΕ and & as ΚΑΙ
+func NormalizeName(s string) string {
+
+	var b strings.Builder
+	for _, r := range StripAccents(FoldHomoglyphs(NFC(s))) {
+		switch {
+		case r == '.' || r == '\'' || r == '΄':
+			// dots join initials, Α.Ε. is ΑΕ
+		case r == '&':
+			b.WriteString(" ΚΑΙ ")
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	return CollapseSpace(b.String())
+}
+
+// nameTokens returns the words of a normalized name without legal forms, and the forms removed
+func nameTokens(s string) ([]string, []string) {
+
+	tokens := strings.Fields(NormalizeName(s))
+
+	var kept, forms []string
+	for i := 0; i < len(tokens); {
+		n := legalFormAt(tokens, i)
+		if n > 0 {
+			forms = append(forms, strings.Join(tokens[i:i+n], " "))
+			i += n
+			continue
+		}
+		kept = append(kept, tokens[i])
+		i++
+	}
+
+	// a name made only of a legal form keeps it
+	if len(kept) == 0 {
+		return tokens, nil
+	}
+
+	return kept, forms
+}
+
+// legalFormAt returns how many tokens of a legal form start at i
+func legalFormAt(tokens []string, i int) int {
+	for _, form := range legalForms {
+		if i+len(form) > len(tokens) {
+			continue
+		}
+		found := true
+		for k := range form {
+			if tokens[i+k] != form[k] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return len(form)
+		}
+	}
+	return 0
+}
+
+func isLatin(tokens []string) bool {
+	for _, t := range tokens {
+		for _, r := range t {
+			if unicode.Is(unicode.Greek, r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func transliterateTokens(tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = Transliterate(t)
+	}
+	return out
+}
+
+// tokenScore is the Dice coefficient of the words, words matching with a small typo count
+func tokenScore(a, b []string) float64 {
+
+	if len(a)+len(b) == 0 {
+		return 0
+	}
+
+	used := make([]bool, len(b))
+	matched := 0.0
+	for _, ta := range a {
+		best, at := 0.0, -1
+		for k, tb := range b {
+			if used[k] {
+				continue
+			}
+			if s := similarity(ta, tb); s > best {
+				best, at = s, k
+			}
+		}
+		if at >= 0 && best >= 0.8 {
+			used[at] = true
+			matched += best
+		}
+	}
+
+	return 2 * matched / float64(len(a)+len(b))
+}
+
+// similarity is 1 minus the edit distance relative to the longer string
+func similarity(a, b string) float64 {
+
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,63 @@
+package rgwspublic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+
+	tests := map[string]string{
+		"Τράπεζα Πειραιώς Α.Ε.":   "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΕ",
+		"Παπαδόπουλος & Σία Ο.Ε.": "ΠΑΠΑΔΟΠΟΥΛΟΣ ΚΑΙ ΣΙΑ ΟΕ",
+		"  ΚΑΦΕ-ΜΠΑΡ  «Η ΩΡΑΙΑ»":  "ΚΑΦΕ ΜΠΑΡ Η ΩΡΑΙΑ",
+	}
+
+	for in, wanted := range tests {
+		if got := NormalizeName(in); got != wanted {
+			t.Errorf("normalize %s, got: %s, wanted: %s", in, got, wanted)
+		}
+	}
+}
+
+func TestMatchName(t *testing.T) {
+
+	r := testSnapshot(t, testVATInfoResponse).Result
+
+	tests := []struct {
+		input string
+		match bool
+		field string
+	}{
+		{"Τράπεζα Πειραιώς ΑΕ", true, "onomasia"},
+		{"ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ", true, "onomasia"},
+		{"τραπεζα πειραιως", true, "onomasia"},
+		{"Πειραιώς Τράπεζα", true, "onomasia"},
+		{"Τραπεζα Περαιως", true, "onomasia"},
+		{"Trapeza Peiraios SA", true, "onomasia"},
+		{"Εθνική Τράπεζα", false, ""},
+		{"Αλφα Ασφαλιστική", false, ""},
+	}
+
+	for _, tt := range tests {
+		m := MatchName(tt.input, r)
+		if m.Match != tt.match {
+			t.Errorf("%s: match %v, wanted: %v, explanation: %s", tt.input, m.Match, tt.match, strings.Join(m.Explanation, "; "))
+		}
+		if tt.field != "" && m.Field != tt.field {
+			t.Errorf("%s: matched %s, wanted: %s", tt.input, m.Field, tt.field)
+		}
+		if len(m.Explanation) == 0 {
+			t.Errorf("%s: no explanation", tt.input)
+		}
+	}
+
+	m := MatchName("Τράπεζα Πειραιώς Α.Ε.", r)
+	if m.Score != 1 || !strings.Contains(strings.Join(m.Explanation, "; "), "ignored legal forms") {
+		t.Errorf("unexpected match: %+v", m)
+	}
+
+	if m := (NameMatcher{Threshold: 0.99}).Match("Τραπεζα Περαιως", r); m.Match {
+		t.Errorf("a typo should not reach a strict threshold: %+v", m)
+	}
+}
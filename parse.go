@@ -0,0 +1,149 @@
+package rgwspublic
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"strings"
+)
+
+// DefaultMaxResponseSize is the largest response body read, if the client sets none
+const DefaultMaxResponseSize = 1 << 20
+
+// errors of responses that can't be parsed, wrapped by ParseError
+var (
+	ErrResponseTooLarge = errors.New("response exceeds the maximum size")
+	ErrNotSOAP          = errors.New("response is not a soap envelope")
+	ErrMalformedXML     = errors.New("response is malformed xml")
+)
+
+// ParseError is a response that couldn't be parsed
+// Err is ErrResponseTooLarge, ErrNotSOAP or ErrMalformedXML
+type ParseError struct {
+	Err         error
+	ContentType string
+	Detail      string
+}
+
+func (e *ParseError) Error() string {
+	s := e.Err.Error()
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	return s
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// boundedReader fails with ErrResponseTooLarge once more than n bytes are read
+type boundedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+
+	if b.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+
+	n, err := b.r.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return n, ErrResponseTooLarge
+	}
+
+	return n, err
+}
+
+func (c *Client) maxResponseSize() int64 {
+	if c.MaxResponseSize <= 0 {
+		return DefaultMaxResponseSize
+	}
+	return c.MaxResponseSize
+}
+
+// isXMLContentType reports whether a response content type may hold a soap envelope
+// an empty type is given the benefit of the doubt
+func isXMLContentType(ct string) bool {
+
+	if ct == "" {
+		return true
+	}
+
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasSuffix(mt, "/xml") || strings.HasSuffix(mt, "+xml")
+}
+
+// decodeSOAP decodes a soap envelope into v as it is read from r
+// a charset from the content type, utf-8 included, overrides the xml declaration, as in RFC 7303
+// returns a *ParseError if r is too large, isn't a soap envelope or isn't xml
+func decodeSOAP(r io.Reader, charset string, v interface{}) error {
+
+	var d *xml.Decoder
+	if charset == "" {
+		d = xml.NewDecoder(r)
+		d.CharsetReader = charsetReader
+	} else {
+		cr, err := charsetReader(charset, r)
+		if err != nil {
+			return &ParseError{Err: ErrMalformedXML, Detail: err.Error()}
+		}
+
+		// already UTF-8, whatever the declaration says
+		d = xml.NewDecoder(cr)
+		d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return parseError(err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local != "Envelope" {
+				return &ParseError{Err: ErrNotSOAP, Detail: "root element is " + tok.Name.Local}
+			}
+			if err := d.DecodeElement(v, &tok); err != nil {
+				return parseError(err)
+			}
+			return nil
+
+		case xml.CharData:
+			if strings.TrimSpace(string(tok)) != "" {
+				return &ParseError{Err: ErrNotSOAP, Detail: "text before the root element"}
+			}
+		}
+	}
+}
+
+// parseError classifies an error of the xml decoder
+func parseError(err error) error {
+
+	switch {
+	case errors.Is(err, ErrResponseTooLarge):
+		return &ParseError{Err: ErrResponseTooLarge}
+	case err == io.EOF:
+		return &ParseError{Err: ErrNotSOAP, Detail: "empty response"}
+	}
+
+	var se *xml.SyntaxError
+	if errors.As(err, &se) || err == io.ErrUnexpectedEOF {
+		return &ParseError{Err: ErrMalformedXML, Detail: err.Error()}
+	}
+
+	return err
+}
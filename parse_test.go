@@ -0,0 +1,128 @@
+package rgwspublic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResponseParseErrors(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		err         error
+	}{
+		{"html page", "text/html; charset=utf-8", "<html><body>Service Unavailable</body></html>", ErrNotSOAP},
+		{"other root", "text/xml", "<html><body/></html>", ErrNotSOAP},
+		{"text", "application/soap+xml", "maintenance", ErrNotSOAP},
+		{"empty", "application/soap+xml", "", ErrNotSOAP},
+		{"truncated", "application/soap+xml", testVATInfoResponse[:len(testVATInfoResponse)/2], ErrMalformedXML},
+		{"oversized", "application/soap+xml", testVATInfoResponse, ErrResponseTooLarge},
+	}
+
+	for _, tt := range tests {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			fmt.Fprint(w, tt.body)
+		})
+		c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+		if tt.err == ErrResponseTooLarge {
+			c.MaxResponseSize = 512
+		}
+
+		r, err := c.LookupResponse("", "094014298")
+		var pe *ParseError
+		if !errors.Is(err, tt.err) || !errors.As(err, &pe) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.err, err)
+			continue
+		}
+		if pe.ContentType != tt.contentType {
+			t.Errorf("%s: unexpected content type: %q", tt.name, pe.ContentType)
+		}
+
+		// what was read is kept, up to the limit
+		if r == nil || r.Info != nil || !strings.HasPrefix(tt.body, string(r.Raw)) {
+			t.Errorf("%s: unexpected response: %+v", tt.name, r)
+		}
+		if tt.err == ErrResponseTooLarge && len(r.Raw) > 513 {
+			t.Errorf("%s: read %d bytes past the limit", tt.name, len(r.Raw))
+		}
+	}
+}
+
+func TestResponseWithinLimit(t *testing.T) {
+
+	c := newTestClient(t, respond(testVATInfoResponse))
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.MaxResponseSize = int64(len(testVATInfoResponse))
+
+	if _, err := c.Lookup("", "094014298"); err != nil {
+		t.Errorf("error looking up: %s", err)
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+
+	page := strings.Repeat("<p>bad gateway</p>", 100)
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		detail      error
+	}{
+		{"large html", http.StatusBadGateway, "text/html", page, nil},
+		{"html as xml", http.StatusInternalServerError, "text/xml", "<html><body>internal error</body></html>", ErrNotSOAP},
+		{"html untyped", http.StatusInternalServerError, "", "<html><body>internal error</body></html>", ErrNotSOAP},
+		{"malformed", http.StatusInternalServerError, "application/soap+xml", "<env:Envelope><env:Body>", ErrMalformedXML},
+		{"large fault", http.StatusInternalServerError, "application/soap+xml", testFaultResponse + page, ErrResponseTooLarge},
+	}
+
+	for _, tt := range tests {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["Content-Type"] = []string{tt.contentType}
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.body)
+		})
+		c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+		c.MaxResponseSize = 512
+		c.Breaker = &CircuitBreaker{MinCalls: 1}
+
+		// the status is the error, what was wrong with the body only its detail
+		r, err := c.LookupResponse("", "094014298")
+		if err == nil || !strings.HasPrefix(err.Error(), fmt.Sprintf("HTTP Status: %d", tt.status)) {
+			t.Errorf("%s: expected an http status error, got: %v", tt.name, err)
+		}
+		var pe *ParseError
+		if detail := errors.As(err, &pe); detail != (tt.detail != nil) || (detail && !errors.Is(err, tt.detail)) {
+			t.Errorf("%s: unexpected detail: %v", tt.name, err)
+		}
+		if r == nil || !strings.HasPrefix(tt.body, string(r.Raw)) || len(r.Raw) > 513 {
+			t.Errorf("%s: body not kept up to the limit: %+v", tt.name, r)
+		}
+		if c.Breaker.State() != CircuitOpen {
+			t.Errorf("%s: not counted as a failure by the breaker", tt.name)
+		}
+	}
+}
+
+func TestIsXMLContentType(t *testing.T) {
+
+	for ct, want := range map[string]bool{
+		"":                                    true,
+		"application/soap+xml; charset=utf-8": true,
+		"text/xml;charset=UTF-8":              true,
+		"application/xml":                     true,
+		"text/html":                           false,
+		"text/plain; charset=utf-8":           false,
+		"application/json":                    false,
+	} {
+		if got := isXMLContentType(ct); got != want {
+			t.Errorf("%q: got %t", ct, got)
+		}
+	}
+}
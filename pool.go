@@ -0,0 +1,223 @@
+package rgwspublic
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrPoolExhausted = errors.New("all pooled accounts are out of rotation")
+
+// CredentialsReporter is implemented by providers that want to know
+// the service error code of calls made with the credentials they returned
+type CredentialsReporter interface {
+	// Report is called after the service answered, code is empty on success
+	Report(c Credentials, code string)
+}
+
+// PoolStrategy picks an account of a CredentialPool
+type PoolStrategy int
+
+const (
+	RoundRobin PoolStrategy = iota // accounts in turn
+	LeastUsed                      // account with fewest calls today
+)
+
+// codes taking an account out of rotation for the rest of the day
+var poolExcludeCodes = map[string]bool{
+	"RG_WS_PUBLIC_MAX_DAILY_USERNAME_CALLS_EXCEEDED": true,
+	"RG_WS_PUBLIC_TOKEN_AFM_BLOCKED":                 true,
+	"RG_WS_PUBLIC_AFM_CALLED_BY_BLOCKED":             true,
+}
+
+// AccountUsage reports the usage of a pooled account
+type AccountUsage struct {
+	Name          string            `json:"name"`
+	Username      string            `json:"username"`
+	Calls         uint64            `json:"calls"`       // since the pool was created
+	CallsToday    uint64            `json:"calls_today"` // since midnight
+	Codes         map[string]uint64 `json:"codes"`       // service error codes returned
+	ExcludedUntil time.Time         `json:"excluded_until,omitempty"`
+	ExcludedBy    string            `json:"excluded_by,omitempty"` // code that took it out of rotation
+}
+
+type poolAccount struct {
+	provider CredentialsProvider
+	usage    AccountUsage
+	day      time.Time // end of the day CallsToday counts
+}
+
+// CredentialPool spreads calls across several accounts,
+// e.g. special access credentials of different legal entities
+// an account returning a daily limit or block code is skipped until midnight
+type CredentialPool struct {
+	// Strategy to pick an account, RoundRobin by default
+	Strategy PoolStrategy
+
+	// Location of the day boundary, time.Local if nil
+	Location *time.Location
+
+	mu       sync.Mutex
+	accounts []*poolAccount
+	next     int
+	now      func() time.Time
+}
+
+// NewCredentialPool returns an empty pool using the given strategy
+func NewCredentialPool(strategy PoolStrategy) *CredentialPool {
+	return &CredentialPool{Strategy: strategy}
+}
+
+// Add an account to the pool, its credentials are read from provider
+func (p *CredentialPool) Add(name string, provider CredentialsProvider) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.accounts = append(p.accounts, &poolAccount{
+		provider: provider,
+		usage:    AccountUsage{Name: name, Codes: map[string]uint64{}},
+	})
+}
+
+// Credentials picks an account in rotation and returns its credentials
+func (p *CredentialPool) Credentials() (Credentials, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clock()
+	var err error = ErrPoolExhausted
+
+	// accounts whose provider fails are skipped too
+	tried := map[*poolAccount]bool{}
+	for len(tried) < len(p.accounts) {
+
+		a := p.pick(now, tried)
+		if a == nil {
+			break
+		}
+		tried[a] = true
+
+		var c Credentials
+		c, err = a.provider.Credentials()
+		if err != nil {
+			continue
+		}
+
+		a.usage.Username = c.Username
+		a.usage.Calls++
+		a.usage.CallsToday++
+		return c, nil
+	}
+
+	return Credentials{}, err
+}
+
+// pick returns the next available account or nil
+func (p *CredentialPool) pick(now time.Time, skip map[*poolAccount]bool) *poolAccount {
+
+	var picked *poolAccount
+	for i := range p.accounts {
+
+		idx := (p.next + i) % len(p.accounts)
+		a := p.accounts[idx]
+		p.rollover(a, now)
+		if skip[a] || now.Before(a.usage.ExcludedUntil) {
+			continue
+		}
+
+		if p.Strategy == RoundRobin {
+			p.next = idx + 1
+			return a
+		}
+
+		if picked == nil || a.usage.CallsToday < picked.usage.CallsToday {
+			picked = a
+		}
+	}
+
+	return picked
+}
+
+// Report counts a service error code and takes the account
+// out of rotation for the rest of the day if needed
+func (p *CredentialPool) Report(c Credentials, code string) {
+
+	if code == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, a := range p.accounts {
+		if a.usage.Username != c.Username {
+			continue
+		}
+
+		a.usage.Codes[code]++
+		if poolExcludeCodes[code] {
+			a.usage.ExcludedUntil = p.midnight(p.clock())
+			a.usage.ExcludedBy = code
+		}
+		return
+	}
+}
+
+// Usage returns a report for each account, in the order they were added
+func (p *CredentialPool) Usage() []AccountUsage {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clock()
+	usage := make([]AccountUsage, 0, len(p.accounts))
+	for _, a := range p.accounts {
+		p.rollover(a, now)
+
+		u := a.usage
+		u.Codes = make(map[string]uint64, len(a.usage.Codes))
+		for k, v := range a.usage.Codes {
+			u.Codes[k] = v
+		}
+		usage = append(usage, u)
+	}
+
+	return usage
+}
+
+// rollover resets daily usage after midnight
+func (p *CredentialPool) rollover(a *poolAccount, now time.Time) {
+
+	day := p.midnight(now)
+	if a.day.Equal(day) {
+		return
+	}
+
+	a.day = day
+	a.usage.CallsToday = 0
+	if !now.Before(a.usage.ExcludedUntil) {
+		a.usage.ExcludedUntil = time.Time{}
+		a.usage.ExcludedBy = ""
+	}
+}
+
+// midnight returns the start of the day after t
+func (p *CredentialPool) midnight(t time.Time) time.Time {
+
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+}
+
+func (p *CredentialPool) clock() time.Time {
+	if p.now == nil {
+		return time.Now()
+	}
+	return p.now()
+}
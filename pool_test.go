@@ -0,0 +1,123 @@
+package rgwspublic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoolRoundRobin(t *testing.T) {
+
+	p := NewCredentialPool(RoundRobin)
+	p.Add("alpha", StaticCredentials{Username: "alphauser", Password: "password"})
+	p.Add("beta", StaticCredentials{Username: "betauser", Password: "password"})
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		c, err := p.Credentials()
+		if err != nil {
+			t.Fatalf("error getting credentials: %s", err)
+		}
+		got = append(got, c.Username)
+	}
+
+	if strings.Join(got, ",") != "alphauser,betauser,alphauser,betauser" {
+		t.Errorf("unexpected rotation: %v", got)
+	}
+}
+
+func TestPoolLeastUsed(t *testing.T) {
+
+	p := NewCredentialPool(LeastUsed)
+	p.Add("alpha", StaticCredentials{Username: "alphauser", Password: "password"})
+	p.Add("broken", StaticCredentials{Username: "short", Password: "password"})
+	p.Add("beta", StaticCredentials{Username: "betauser", Password: "password"})
+
+	// use alpha twice, beta should be picked until it catches up
+	p.Credentials()
+	p.Credentials()
+	p.Credentials()
+
+	usage := p.Usage()
+	if usage[0].CallsToday != 2 || usage[1].CallsToday != 0 || usage[2].CallsToday != 1 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestPoolExclusion(t *testing.T) {
+
+	now := time.Date(2021, 11, 22, 15, 0, 0, 0, time.UTC)
+	p := NewCredentialPool(RoundRobin)
+	p.Location = time.UTC
+	p.now = func() time.Time { return now }
+	p.Add("alpha", StaticCredentials{Username: "alphauser", Password: "password"})
+	p.Add("beta", StaticCredentials{Username: "betauser", Password: "password"})
+
+	// usernames are known after the first pick
+	p.Credentials()
+	p.Credentials()
+	p.Report(Credentials{Username: "alphauser"}, "RG_WS_PUBLIC_MAX_DAILY_USERNAME_CALLS_EXCEEDED")
+	p.Report(Credentials{Username: "betauser"}, "RG_WS_PUBLIC_TAXPAYER_NF")
+
+	for i := 0; i < 3; i++ {
+		c, err := p.Credentials()
+		if err != nil || c.Username != "betauser" {
+			t.Fatalf("expected beta while alpha is excluded, got: %s, error: %v", c.Username, err)
+		}
+	}
+
+	p.Report(Credentials{Username: "betauser"}, "RG_WS_PUBLIC_TOKEN_AFM_BLOCKED")
+	if _, err := p.Credentials(); err != ErrPoolExhausted {
+		t.Errorf("expected exhausted pool, got: %v", err)
+	}
+
+	usage := p.Usage()
+	if usage[0].ExcludedBy != "RG_WS_PUBLIC_MAX_DAILY_USERNAME_CALLS_EXCEEDED" {
+		t.Errorf("unexpected exclusion: %+v", usage[0])
+	}
+	if usage[1].Codes["RG_WS_PUBLIC_TAXPAYER_NF"] != 1 {
+		t.Errorf("unexpected codes: %+v", usage[1].Codes)
+	}
+
+	// back in rotation the next day
+	now = now.Add(10 * time.Hour)
+	if _, err := p.Credentials(); err != nil {
+		t.Errorf("expected accounts back in rotation, got: %v", err)
+	}
+	if usage := p.Usage(); usage[0].CallsToday+usage[1].CallsToday != 1 {
+		t.Errorf("daily usage not reset: %+v", usage)
+	}
+}
+
+func TestPoolClient(t *testing.T) {
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(b), "<ns1:Username>alphauser</ns1:Username>") {
+			respond(testErrorResponse("RG_WS_PUBLIC_MAX_DAILY_USERNAME_CALLS_EXCEEDED"))(w, r)
+			return
+		}
+		respond(testVATInfoResponse)(w, r)
+	})
+
+	p := NewCredentialPool(RoundRobin)
+	p.Add("alpha", StaticCredentials{Username: "alphauser", Password: "password"})
+	p.Add("beta", StaticCredentials{Username: "betauser", Password: "password"})
+	c.Credentials = p
+
+	if _, err := c.Lookup("", "094014298"); err == nil {
+		t.Fatalf("expected daily limit error for alpha")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Lookup("", "094014298"); err != nil {
+			t.Fatalf("error looking up with beta: %s", err)
+		}
+	}
+
+	usage := p.Usage()
+	if usage[0].Calls != 1 || usage[1].Calls != 2 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
@@ -0,0 +1,162 @@
+package rgwspublic
+
+import (
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/report.html templates/report.md
+var reportTemplates embed.FS
+
+// verdicts of a due diligence report
+const (
+	VerdictPass   = "pass"   // active business in the normal VAT system
+	VerdictReview = "review" // valid, but needs a human to look at it
+	VerdictFail   = "fail"   // deactivated, stopped or unknown to the registry
+)
+
+// report template functions, shared by the html and markdown templates
+var reportFuncs = map[string]interface{}{
+	"kad":    func(code int) string { return fmt.Sprintf("%08d", code) },
+	"date":   registryDate,
+	"squash": squash,
+	"md":     markdownEscape,
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04:05 -07:00")
+	},
+}
+
+// markdownEscaper keeps a value in its table cell or list item
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// markdownEscape escapes a value for the markdown report
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// ReportHTMLTemplate returns a new copy of the default html template
+// it defines the blocks header, record, status, activities, verdict and footer,
+// parse your own definitions into it to replace them
+func ReportHTMLTemplate() *htmltemplate.Template {
+	return htmltemplate.Must(htmltemplate.New("report.html").
+		Funcs(reportFuncs).ParseFS(reportTemplates, "templates/report.html"))
+}
+
+// ReportMarkdownTemplate returns a new copy of the default markdown template, with the same blocks
+func ReportMarkdownTemplate() *texttemplate.Template {
+	return texttemplate.Must(texttemplate.New("report.md").
+		Funcs(reportFuncs).ParseFS(reportTemplates, "templates/report.md"))
+}
+
+// default templates, parsed once
+var (
+	defaultReportHTML     = ReportHTMLTemplate()
+	defaultReportMarkdown = ReportMarkdownTemplate()
+)
+
+// ReportFuncs returns the functions the default templates use, for templates of your own
+// kad formats an activity code, date drops the offset of a registry date
+func ReportFuncs() map[string]interface{} {
+	funcs := map[string]interface{}{}
+	for k, v := range reportFuncs {
+		funcs[k] = v
+	}
+	return funcs
+}
+
+// Report is the evidence of a counterparty check
+type Report struct {
+	Info *VATInfo
+
+	// Time of the lookup, CallSeqID and CalledBy come from Info
+	Time time.Time
+
+	// Verdict is one of VerdictPass, VerdictReview or VerdictFail, with the reasons in greek
+	Verdict string
+	Reasons []string
+
+	// Generated is when the report was made
+	Generated time.Time
+
+	// templates used instead of the defaults, if set
+	HTMLTemplate     *htmltemplate.Template
+	MarkdownTemplate *texttemplate.Template
+}
+
+// NewReport makes a report of a lookup done at t and gives its verdict
+// descriptions are checked in their NormalizeGreek form and shown as returned
+func NewReport(info *VATInfo, t time.Time) *Report {
+
+	r := &Report{Info: info, Time: t, Generated: time.Now()}
+	res := info.Result
+
+	if err := info.error(); err != nil {
+		r.fail(fmt.Sprintf("απάντηση μητρώου %s: %s", info.Error.Code, info.Error.Message))
+	}
+	if squash(res.DeactivationFlag) == "2" {
+		r.fail("ο ΑΦΜ είναι απενεργοποιημένος")
+	}
+	if stop := registryDate(res.StopDate); stop != "" {
+		r.fail("διακοπή εργασιών στις " + stop)
+	}
+	if firm := squash(res.FirmFlagDescription); firm != "" && NormalizeGreek(firm) != "ΕΠΙΤΗΔΕΥΜΑΤΙΑΣ" {
+		r.review("δεν είναι ενεργός επιτηδευματίας: " + firm)
+	}
+	if flag := squash(res.NormalVATSystemFlag); flag != "" && NormalizeGreek(flag) != "Y" {
+		r.review("δεν υπάγεται στο κανονικό καθεστώς ΦΠΑ")
+	}
+
+	if r.Verdict == "" {
+		r.Verdict = VerdictPass
+		r.Reasons = append(r.Reasons, "ενεργός επιτηδευματίας στο κανονικό καθεστώς ΦΠΑ")
+	}
+
+	return r
+}
+
+func (r *Report) fail(reason string) {
+	r.Verdict = VerdictFail
+	r.Reasons = append(r.Reasons, reason)
+}
+
+func (r *Report) review(reason string) {
+	if r.Verdict != VerdictFail {
+		r.Verdict = VerdictReview
+	}
+	r.Reasons = append(r.Reasons, reason)
+}
+
+// WriteHTML renders the report as a self-contained html page
+func (r *Report) WriteHTML(w io.Writer) error {
+	t := r.HTMLTemplate
+	if t == nil {
+		t = defaultReportHTML
+	}
+	return t.Execute(w, r)
+}
+
+// WriteMarkdown renders the report as markdown
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	t := r.MarkdownTemplate
+	if t == nil {
+		t = defaultReportMarkdown
+	}
+	return t.Execute(w, r)
+}
+
+// registryDate drops the offset the service appends to dates, e.g. 2021-11-22+02:00
+func registryDate(s string) string {
+	s = squash(s)
+	if len(s) > 10 && (s[10] == '+' || s[10] == '-' || s[10] == 'Z') {
+		return s[:10]
+	}
+	return s
+}
@@ -0,0 +1,116 @@
+package rgwspublic
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+
+	at := time.Date(2021, 11, 22, 10, 30, 0, 0, time.UTC)
+	r := NewReport(testSnapshot(t, testVATInfoResponse), at)
+	if r.Verdict != VerdictPass {
+		t.Errorf("unexpected verdict: %s %v", r.Verdict, r.Reasons)
+	}
+
+	var html, md bytes.Buffer
+	if err := r.WriteHTML(&html); err != nil {
+		t.Fatalf("error writing html: %s", err)
+	}
+	if err := r.WriteMarkdown(&md); err != nil {
+		t.Fatalf("error writing markdown: %s", err)
+	}
+
+	wanted := []string{
+		"2021-11-22 10:30:00",
+		"46447592",
+		"USERNAME1",
+		"ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ",
+		"1159 ΦΑΕ ΑΘΗΝΩΝ",
+		"64191204",
+		"ΕΠΙΤΗΔΕΥΜΑΤΙΑΣ",
+		"1916-01-01",
+		"ΕΓΚΡΙΣΗ",
+	}
+	for _, w := range wanted {
+		if !strings.Contains(html.String(), w) {
+			t.Errorf("html is missing %s", w)
+		}
+		if !strings.Contains(md.String(), w) {
+			t.Errorf("markdown is missing %s", w)
+		}
+	}
+	if !strings.Contains(md.String(), "| 64191204 |") {
+		t.Errorf("activities not in a markdown table:\n%s", md.String())
+	}
+	if strings.Contains(html.String(), "<link") || strings.Contains(html.String(), "<script") {
+		t.Errorf("html should be self-contained")
+	}
+}
+
+func TestReportMarkdownEscape(t *testing.T) {
+
+	info := testSnapshot(t, testVATInfoResponse)
+	info.Result.Onomasia = "Α|Β"
+	info.CalledBy.TokenAFMFullName = "ΠΡΩΤΗ\nΔΕΥΤΕΡΗ"
+
+	r := NewReport(info, time.Now())
+	r.Reasons = append(r.Reasons, "ΓΡΑΜΜΗ\nΝΕΑ")
+
+	var md bytes.Buffer
+	if err := r.WriteMarkdown(&md); err != nil {
+		t.Fatalf("error writing markdown: %s", err)
+	}
+
+	for _, w := range []string{`| Α\|Β |`, "ΠΡΩΤΗ ΔΕΥΤΕΡΗ", "- ΓΡΑΜΜΗ ΝΕΑ\n"} {
+		if !strings.Contains(md.String(), w) {
+			t.Errorf("markdown is missing %s:\n%s", w, md.String())
+		}
+	}
+}
+
+func TestReportVerdicts(t *testing.T) {
+
+	r := NewReport(testSnapshot(t, testChangedResponse), time.Now())
+	if r.Verdict != VerdictFail || len(r.Reasons) != 2 {
+		t.Errorf("unexpected verdict: %s %v", r.Verdict, r.Reasons)
+	}
+
+	i := testSnapshot(t, testVATInfoResponse)
+	i.Result.FirmFlagDescription = "ΜΗ ΕΠΙΤΗΔΕΥΜΑΤΙΑΣ"
+	if r := NewReport(i, time.Now()); r.Verdict != VerdictReview {
+		t.Errorf("unexpected verdict: %s %v", r.Verdict, r.Reasons)
+	}
+
+	// compared normalized
+	i.Result.FirmFlagDescription = "Επιτηδευματίας"
+	if r := NewReport(i, time.Now()); r.Verdict != VerdictPass {
+		t.Errorf("unexpected verdict: %s %v", r.Verdict, r.Reasons)
+	}
+
+	if r := NewReport(testSnapshot(t, testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF")), time.Now()); r.Verdict != VerdictFail {
+		t.Errorf("unexpected verdict: %s %v", r.Verdict, r.Reasons)
+	}
+}
+
+func TestReportCustomTemplate(t *testing.T) {
+
+	tmpl := htmltemplate.Must(ReportHTMLTemplate().Parse(`{{define "footer"}}<footer>ACME compliance</footer>{{end}}`))
+
+	r := NewReport(testSnapshot(t, testVATInfoResponse), time.Now())
+	r.HTMLTemplate = tmpl
+
+	var buf bytes.Buffer
+	if err := r.WriteHTML(&buf); err != nil {
+		t.Fatalf("error writing html: %s", err)
+	}
+	if !strings.Contains(buf.String(), "ACME compliance") || strings.Contains(buf.String(), "RgWsPublic2 της ΑΑΔΕ") {
+		t.Errorf("footer not replaced")
+	}
+	if !strings.Contains(buf.String(), "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ") {
+		t.Errorf("default blocks should remain")
+	}
+}
@@ -1,13 +1,10 @@
 package rgwspublic
 
 import (
-	"encoding/xml"
+	"bytes"
 	"errors"
-	"fmt"
-	"io/ioutil"
 	"net/http"
-	"strconv"
-	"strings"
+	"time"
 )
 
 var (
@@ -15,9 +12,15 @@ var (
 	ErrInvalidCredentials = errors.New("username or password cannot be less than 6 chars")
 )
 
-// Version gets web service version
+// Version gets web service version using DefaultClient
 // returns a string or an error
 func Version() (*string, error) {
+	return DefaultClient.Version()
+}
+
+// Version gets web service version
+// returns a string or an error
+func (c *Client) Version() (*string, error) {
 
 	body := `<?xml version="1.0" encoding="UTF-8"?>
 		<soap:Envelope 
@@ -29,136 +32,193 @@ func Version() (*string, error) {
 			</soap:Body>
  		</soap:Envelope>`
 
-	req, err := http.NewRequest("POST", Endpoint, strings.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-
-	header := http.Header{}
-	header.Set("Content-Type", "application/soap+xml")
-	header.Set("Connection", "keep-alive")
-	header.Set("Content-Length", strconv.Itoa(len(body)))
-	req.Header = header
+	c.onRequest(OpVersion, "", "")
 
-	resp, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	xmlBody, resp, err := c.call(body)
+	c.observe(OpVersion, start, xmlBody, err)
 	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Status: %d, error: %s", resp.StatusCode, resp.Status)
-	}
-
-	// parse response
-	xmlBody, err := parseXML(resp)
-	if err != nil {
-		return nil, err
+		return nil, c.onError(err)
 	}
 
 	err = xmlBody.error()
 	if err != nil {
-		return nil, err
+		return nil, c.onError(err)
 	}
 
 	xmlBody.Error = nil // to correct parser creating an object
+	c.onResponse(nil, resp.Raw, time.Since(start))
 	return xmlBody.Version, nil
 
 }
 
-// GetVATInfo associated with a VAT number
+// GetVATInfo associated with a VAT number using DefaultClient
 // accepts a called by VAT and a called for VAT, username and password
 // returns AFMData or an error
 func GetVATInfo(calledby, calledfor, user, pass string) (*VATInfo, error) {
+	return DefaultClient.GetVATInfo(calledby, calledfor, user, pass)
+}
+
+// GetVATInfo associated with a VAT number
+// accepts a called by VAT and a called for VAT, username and password
+// returns AFMData or an error
+func (c *Client) GetVATInfo(calledby, calledfor, user, pass string) (*VATInfo, error) {
+	return withoutError(c.getVATInfo(calledby, calledfor, StaticCredentials{Username: user, Password: pass}, lookupOptions{}))
+}
+
+// Lookup gets VAT info using the credentials provider of the client
+// accepts a called by VAT and a called for VAT, numbers failing ValidateVAT are rejected without a call
+// returns VATInfo or an error
+func (c *Client) Lookup(calledby, calledfor string) (*VATInfo, error) {
+
+	if c.Credentials == nil {
+		return nil, c.onError(ErrNoCredentials)
+	}
+
+	return withoutError(c.getVATInfo(calledby, calledfor, c.Credentials, lookupOptions{}))
+}
 
-	// vat numbers must be between 9 and 12 chars
-	if len(calledfor) < 9 || len(calledfor) > 12 {
-		return nil, ErrInvalidVAT
+// LookupFor is Lookup recording who asked and why in the audit log of the client
+func (c *Client) LookupFor(actor, purpose, calledby, calledfor string) (*VATInfo, error) {
+
+	if c.Credentials == nil {
+		return nil, c.onError(ErrNoCredentials)
+	}
+
+	return withoutError(c.getVATInfo(calledby, calledfor, c.Credentials, lookupOptions{actor: actor, purpose: purpose}))
+}
+
+// lookupOptions are who asked for a lookup and why,
+// and where to keep the exchange if wanted
+type lookupOptions struct {
+	actor, purpose string
+	response       *Response
+}
+
+// audit records a lookup in the audit log, if any
+func (c *Client) audit(opts lookupOptions, calledby, calledfor string, info *VATInfo, raw []byte, err error) error {
+
+	if c.Audit == nil {
+		return nil
+	}
+
+	if aerr := c.Audit.Record(opts.actor, opts.purpose, calledby, calledfor, info, raw, err); aerr != nil {
+		return &AuditWriteError{Err: aerr}
+	}
+
+	return nil
+}
+
+// getVATInfo returns the VATInfo parsed even on service errors
+// so the echoed identity can be inspected
+func (c *Client) getVATInfo(calledby, calledfor string, provider CredentialsProvider, opts lookupOptions) (*VATInfo, error) {
+
+	// act on behalf of the configured AFM, unless told otherwise
+	if calledby == "" {
+		calledby = c.OnBehalfOf
+	}
+
+	// numbers are checked offline, an invalid one is never sent
+	calledfor, err := validateAFM(calledfor)
+	if err != nil {
+		return nil, c.onError(err)
 	}
 	// first one (calledby) can be empty
 	if calledby != "" {
-		if len(calledby) < 9 || len(calledby) > 12 {
-			return nil, ErrInvalidVAT
+		if calledby, err = validateAFM(calledby); err != nil {
+			return nil, c.onError(err)
 		}
 	}
 
-	// same for username/password
-	if len(user) < 6 || len(pass) < 6 {
-		return nil, ErrInvalidCredentials
-	}
-
-	body := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-		<env:Envelope 
-			xmlns:env="http://www.w3.org/2003/05/soap-envelope" 
-			xmlns:ns1="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd" 
-			xmlns:ns2="http://rgwspublic2/RgWsPublic2Service" 
-			xmlns:ns3="http://rgwspublic2/RgWsPublic2">
-			<env:Header>
-	   			<ns1:Security>
-		  			<ns1:UsernameToken>
-			 			<ns1:Username>%v</ns1:Username>
-			 			<ns1:Password>%v</ns1:Password>
-		  			</ns1:UsernameToken>
-	   			</ns1:Security>
-			</env:Header>
-			<env:Body>
-	   			<ns2:rgWsPublic2AfmMethod>
-		  			<ns2:INPUT_REC>
-						<ns3:afm_called_by>%v</ns3:afm_called_by>
-			 			<ns3:afm_called_for>%v</ns3:afm_called_for>
-		  			</ns2:INPUT_REC>
-	   			</ns2:rgWsPublic2AfmMethod>
-			</env:Body>
- 		</env:Envelope>`, user, pass, calledby, calledfor)
-
-	req, err := http.NewRequest("POST", Endpoint, strings.NewReader(body))
+	// the provider validates username/password
+	creds, err := provider.Credentials()
 	if err != nil {
-		return nil, err
+		return nil, c.onError(err)
 	}
 
-	header := http.Header{}
-	header.Set("Content-Type", "application/soap+xml")
-	header.Set("Connection", "keep-alive")
-	header.Set("Content-Length", strconv.Itoa(len(body)))
-	req.Header = header
+	body := vatInfoEnvelope(creds.Username, creds.Password, calledby, calledfor)
+
+	c.onRequest(OpGetVATInfo, calledby, calledfor)
 
-	resp, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	xmlBody, resp, err := c.call(body)
+	c.observe(OpGetVATInfo, start, xmlBody, err)
+	if resp != nil && opts.response != nil {
+		*opts.response = *resp
+	}
 	if err != nil {
-		return nil, err
+		// failed calls are audited too, the call error is what the caller gets
+		var raw []byte
+		if resp != nil {
+			raw = resp.Raw
+		}
+		if aerr := c.audit(opts, calledby, calledfor, nil, raw, err); aerr != nil {
+			c.onError(aerr)
+		}
+		return nil, c.onError(err)
 	}
 
-	defer resp.Body.Close()
+	// let a pool know which account got which answer
+	if r, ok := provider.(CredentialsReporter); ok {
+		code := ""
+		if xmlBody.VATInfo.Error != nil {
+			code = xmlBody.VATInfo.Error.Code
+		}
+		r.Report(creds, code)
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Status: %d, error: %s", resp.StatusCode, resp.Status)
+	info := &xmlBody.VATInfo
+	err = checkDelegation(calledby, info)
+	if opts.response != nil {
+		opts.response.Info, opts.response.CallSeqID = info, info.CallSeqID
 	}
 
-	xmlBody, err := parseXML(resp)
-	if err != nil {
-		return nil, err
+	// a lookup is evidence even when it failed, failing to store it
+	// in the history doesn't fail the lookup, failing to audit it does
+	if c.History != nil {
+		if herr := c.History.Record(calledby, calledfor, info, err); herr != nil {
+			c.onError(herr)
+		}
+	}
+	if aerr := c.audit(opts, calledby, calledfor, info, resp.Raw, err); aerr != nil {
+		return info, c.onError(aerr)
 	}
 
-	err = xmlBody.VATInfo.error()
 	if err != nil {
-		return nil, err
+		return info, c.onError(err)
 	}
 
 	// to correct parser creating an object
-	xmlBody.VATInfo.Error = nil
-	return &xmlBody.VATInfo, nil
+	info.Error = nil
+	c.onResponse(info, resp.Raw, time.Since(start))
+	return info, nil
+}
+
+// withoutError drops a VATInfo returned along with an error
+func withoutError(i *VATInfo, err error) (*VATInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
 }
 
 // helper function to parse xml response
 func parseXML(r *http.Response) (*XMLBody, error) {
 
-	rbody, err := ioutil.ReadAll(r.Body)
+	xmlResp := XMLResponse{}
+	err := decodeSOAP(&boundedReader{r: r.Body, n: DefaultMaxResponseSize}, contentCharset(r.Header.Get("Content-Type")), &xmlResp)
 	if err != nil {
 		return nil, err
 	}
 
+	return &xmlResp.Body, nil
+}
+
+// helper function to decode a raw xml response
+func decodeXML(rbody []byte) (*XMLBody, error) {
+
 	xmlResp := XMLResponse{}
-	err = xml.Unmarshal([]byte(rbody), &xmlResp)
+	err := decodeSOAP(bytes.NewReader(rbody), "", &xmlResp)
 	if err != nil {
 		return nil, err
 	}
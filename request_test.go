@@ -3,10 +3,12 @@ package rgwspublic
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -87,10 +89,10 @@ func TestInvalids(t *testing.T) {
 	// some invalid input to test returned service errors
 	inputs := []map[string]string{
 		{
-			"vat":      "1234567890",
+			"vat":      "1234567890", // rejected before the call
 			"username": "someuser",
 			"password": "somepass",
-			"error":    "RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED",
+			"error":    "invalid",
 		},
 		{
 			"vat":      "104807035",
@@ -99,7 +101,7 @@ func TestInvalids(t *testing.T) {
 			"error":    "RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED",
 		},
 		{
-			"vat":      "1234567890",
+			"vat":      "104807035",
 			"username": "KAMILAKIS1", // valid user but,
 			"password": "hyhyhhyh!",  // wrong pass
 			"error":    "RG_WS_PUBLIC_TOKEN_USERNAME_NOT_AUTHENTICATED",
@@ -116,6 +118,12 @@ func TestInvalids(t *testing.T) {
 	for k, v := range inputs {
 		t.Logf("testing input #%d, vat:%s, user:%s, pass:%s", k, v["vat"], v["username"], v["password"])
 		i, err := GetVATInfo("", v["vat"], v["username"], v["password"])
+		if v["error"] == "invalid" {
+			if !errors.Is(err, ErrInvalidVAT) {
+				t.Errorf("expected an invalid VAT error, got: %v", err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Errorf("error getting AFM info: %s", err.Error())
 			continue
@@ -149,6 +157,31 @@ func TestGetVatInfo(t *testing.T) {
 	t.Logf("json: %s", string(js))
 }
 
+func TestGetVatInfoEnvCredentials(t *testing.T) {
+
+	t.Setenv("GSISUsername", "envuser")
+	t.Setenv("GSISPassword", "envpass")
+
+	var sent bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		sent = strings.Contains(string(b), "<ns1:Username>envuser</ns1:Username>")
+		respond(testVATInfoResponse)(w, r)
+	})
+	c.Credentials = EnvCredentials{}
+
+	i, err := c.Lookup("", "094014298")
+	if err != nil {
+		t.Fatalf("error getting VAT info: %s", err)
+	}
+	if !sent {
+		t.Errorf("credentials from the environment not sent")
+	}
+	if i.Result.AFM != "094014298" {
+		t.Errorf("unexpected AFM, got: %s", i.Result.AFM)
+	}
+}
+
 func TestParseVatInfo(t *testing.T) {
 
 	// a mock http response
@@ -0,0 +1,66 @@
+package rgwspublic
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Response is a lookup along with the exchange behind it,
+// for debugging disputes with AADE support and archiving evidence
+type Response struct {
+	// Info parsed from the response, nil if it couldn't be parsed
+	Info *VATInfo
+
+	// Request is the soap envelope sent, with the username and password redacted
+	Request string
+
+	// Raw response body as received
+	Raw []byte
+
+	StatusCode int
+	Header     http.Header
+
+	// Time the request was sent and how long until the response was read
+	Time     time.Time
+	Duration time.Duration
+
+	// CallSeqID identifies the call at AADE
+	CallSeqID int
+}
+
+// the username and password elements of a soap envelope, their values are escaped so hold no '<'
+var credentialElement = regexp.MustCompile(`(<(?:[\w-]+:)?(?:Username|Password)>)[^<]*(</)`)
+
+// redactCredentials hides the username and password of a soap envelope
+func redactCredentials(body string) string {
+	return credentialElement.ReplaceAllString(body, "${1}***${2}")
+}
+
+// LookupResponse is Lookup returning the exchange with the service
+// the response is returned along with service errors, and with http errors once the request was sent
+func (c *Client) LookupResponse(calledby, calledfor string) (*Response, error) {
+
+	if c.Credentials == nil {
+		return nil, c.onError(ErrNoCredentials)
+	}
+
+	return c.lookupResponse(calledby, calledfor, c.Credentials)
+}
+
+// GetVATInfoResponse is GetVATInfo returning the exchange with the service
+func (c *Client) GetVATInfoResponse(calledby, calledfor, user, pass string) (*Response, error) {
+	return c.lookupResponse(calledby, calledfor, StaticCredentials{Username: user, Password: pass})
+}
+
+func (c *Client) lookupResponse(calledby, calledfor string, provider CredentialsProvider) (*Response, error) {
+
+	r := &Response{}
+	_, err := c.getVATInfo(calledby, calledfor, provider, lookupOptions{response: r})
+	if r.Time.IsZero() {
+		// the request was never sent
+		return nil, err
+	}
+
+	return r, err
+}
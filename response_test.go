@@ -0,0 +1,69 @@
+package rgwspublic
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLookupResponse(t *testing.T) {
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		respond(testVATInfoResponse)(w, r)
+	})
+	c.Credentials = StaticCredentials{Username: "username", Password: "s3cr&t<pass"}
+
+	r, err := c.LookupResponse("", "094014298")
+	if err != nil {
+		t.Fatalf("error looking up: %s", err)
+	}
+
+	if r.Info == nil || r.Info.Result.AFM != "094014298" || r.CallSeqID != 46447592 {
+		t.Errorf("unexpected info: %+v", r.Info)
+	}
+	if r.StatusCode != http.StatusOK || r.Header.Get("X-Request-Id") != "abc" {
+		t.Errorf("unexpected status or headers: %d %v", r.StatusCode, r.Header)
+	}
+	if string(r.Raw) != testVATInfoResponse {
+		t.Errorf("raw response differs from what was sent")
+	}
+	if r.Time.IsZero() || r.Duration <= 0 {
+		t.Errorf("missing timing: %s %s", r.Time, r.Duration)
+	}
+	if strings.Contains(r.Request, "s3cr") || !strings.Contains(r.Request, "<ns1:Password>***</ns1:Password>") {
+		t.Errorf("password not redacted: %s", r.Request)
+	}
+	if strings.Contains(r.Request, ">username<") || !strings.Contains(r.Request, "<ns1:Username>***</ns1:Username>") {
+		t.Errorf("username not redacted: %s", r.Request)
+	}
+	if !strings.Contains(r.Request, "094014298") {
+		t.Errorf("redacted more than the credentials: %s", r.Request)
+	}
+}
+
+func TestLookupResponseErrors(t *testing.T) {
+
+	// service errors come with the response
+	c := newTestClient(t, respond(testErrorResponse("RG_WS_PUBLIC_TAXPAYER_NF")))
+	r, err := c.GetVATInfoResponse("", "094014298", "username", "password")
+	var se *ServiceError
+	if !errors.As(err, &se) || r == nil || r.Info == nil || len(r.Raw) == 0 {
+		t.Errorf("expected a service error with the response, got: %v %+v", err, r)
+	}
+
+	// http errors too, without info
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	r, err = c.GetVATInfoResponse("", "094014298", "username", "password")
+	if err == nil || r == nil || r.StatusCode != http.StatusServiceUnavailable || r.Info != nil || !strings.Contains(string(r.Raw), "maintenance") {
+		t.Errorf("expected an http error with the response, got: %v %+v", err, r)
+	}
+
+	// nothing was sent
+	if r, err := c.GetVATInfoResponse("", "0940", "username", "password"); !errors.Is(err, ErrInvalidVAT) || r != nil {
+		t.Errorf("expected no response, got: %v %+v", err, r)
+	}
+}
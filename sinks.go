@@ -0,0 +1,140 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// headers of a webhook request
+const (
+	WebhookSignatureHeader = "X-Rgwspublic-Signature"
+	WebhookTimestampHeader = "X-Rgwspublic-Timestamp"
+)
+
+// EventSink receives change events of a Monitor
+type EventSink interface {
+	Emit(e ChangeEvent) error
+}
+
+// SinkFunc is a Go callback receiving change events
+type SinkFunc func(e ChangeEvent) error
+
+// Emit calls f(e)
+func (f SinkFunc) Emit(e ChangeEvent) error {
+	return f(e)
+}
+
+// JSONLSink appends change events to a file, one json object per line
+type JSONLSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Emit appends e to the file
+func (s *JSONLSink) Emit(e ChangeEvent) error {
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// WebhookSink posts change events as json to a url
+// the body is signed with HMAC-SHA256, see SignWebhook
+type WebhookSink struct {
+	URL    string
+	Secret []byte
+
+	// Retries after a failed delivery, with Backoff doubled each time
+	Retries int
+	Backoff time.Duration
+
+	// HTTPClient used for delivery, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Emit delivers e, retrying on transport errors and non 2xx responses
+func (s *WebhookSink) Emit(e ChangeEvent) error {
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	hc := s.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	for i := 0; ; i++ {
+
+		err = s.post(hc, body)
+		if err == nil || i >= s.Retries {
+			return err
+		}
+
+		time.Sleep(s.Backoff << uint(i))
+	}
+}
+
+func (s *WebhookSink) post(hc *http.Client, body []byte) error {
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, ts)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(s.Secret, ts, body))
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook HTTP Status: %d, error: %s", resp.StatusCode, resp.Status)
+	}
+
+	return nil
+}
+
+// SignWebhook returns the signature of a webhook body sent at timestamp
+// receivers compute it again and compare it with hmac.Equal
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
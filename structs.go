@@ -3,7 +3,8 @@ package rgwspublic
 import (
 	"encoding/xml"
 	"errors"
-	"fmt"
+	"strconv"
+	"strings"
 )
 
 // XMLResponse is where we parse an http response
@@ -44,6 +45,9 @@ type VATInfo struct {
 	Result     VATResult      `xml:"basic_rec"  json:"result"`
 	Activities []FirmActivity `xml:"firm_act_tab>item" json:"activities"`
 	Error      *ErrorVATInfo  `xml:"error_rec" json:"error,omitempty"`
+
+	// Normalized holds the text fields in NormalizeGreek form, set when the record is parsed
+	Normalized *NormalizedInfo `xml:"-" json:"normalized,omitempty"`
 }
 
 func (b *VATInfo) error() error {
@@ -56,7 +60,7 @@ func (b *VATInfo) error() error {
 		return nil
 	}
 
-	return errors.New(b.Error.Message)
+	return &ServiceError{Code: b.Error.Code, Message: b.Error.Message}
 }
 
 // ErrorVATInfo holds error info
@@ -65,6 +69,16 @@ type ErrorVATInfo struct {
 	Message string `xml:"error_descr" json:"message"`
 }
 
+// ServiceError is an RG_WS_PUBLIC_* error returned by the service
+type ServiceError struct {
+	Code    string
+	Message string
+}
+
+func (e *ServiceError) Error() string {
+	return e.Message
+}
+
 // VATCalledBy is the data relative to who did the search
 type VATCalledBy struct {
 	TokenUsername       string `xml:"token_username" json:"username"`
@@ -75,6 +89,11 @@ type VATCalledBy struct {
 	AsOnDate            string `xml:"as_on_date" json:"as_on_date"`
 }
 
+// Delegated reports whether the token acted on behalf of another AFM
+func (v *VATCalledBy) Delegated() bool {
+	return v.AFMCalledBy != "" && strings.TrimSpace(v.AFMCalledBy) != strings.TrimSpace(v.TokenAFM)
+}
+
 // VATResult is the data relative to an entity's VAT search
 type VATResult struct {
 	AFM                         string `xml:"afm" json:"afm"`                                              // ΑΦΜ
@@ -128,38 +147,63 @@ const (
 )
 
 func (a *VATInfo) String() string {
-	var s string
-
-	s += fmt.Sprintf("afm:%s\n", a.Result.AFM)
-	s += fmt.Sprintf("doy:%s\n", a.Result.DOY)
-	s += fmt.Sprintf("doy_descr:%s\n", a.Result.DOYDescription)
-	s += fmt.Sprintf("i_ni_flag_descr:%s\n", a.Result.InitialFlagDescription)
-	s += fmt.Sprintf("deactivation_flag:%s\n", a.Result.DeactivationFlag)
-	s += fmt.Sprintf("deactivation_flag_desc:%s\n", a.Result.DeactivationFlagDescription)
-	s += fmt.Sprintf("firm_flag_descr:%s\n", a.Result.FirmFlagDescription)
-	s += fmt.Sprintf("onomasia:%s\n", a.Result.Onomasia)
-	s += fmt.Sprintf("commer_title:%s\n", a.Result.CommercialTitle)
-	s += fmt.Sprintf("legal_status_descr:%s\n", a.Result.LegalStatusDescription)
-	s += fmt.Sprintf("postal_address:%s\n", a.Result.PostalAddress)
-	s += fmt.Sprintf("postal_address_no:%s\n", a.Result.PostalAddressNo)
-	s += fmt.Sprintf("postal_zip_code:%s\n", a.Result.PostalZipCode)
-	s += fmt.Sprintf("postal_area_description:%s\n", a.Result.PostalAreaDescription)
-	s += fmt.Sprintf("regist_date:%s\n", a.Result.RegistrationDate)
-	s += fmt.Sprintf("stop_date:%s\n", a.Result.StopDate)
-	s += fmt.Sprintf("normal_vat_system_flag:%s\n", a.Result.NormalVATSystemFlag)
-
-	s += fmt.Sprintf("ACTIVITIES:--------------------\n")
+
+	var b strings.Builder
+	b.Grow(2048 + 256*len(a.Activities))
+	var num [20]byte
+
+	field := func(name, value string) {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+
+	field("afm", a.Result.AFM)
+	field("doy", a.Result.DOY)
+	field("doy_descr", a.Result.DOYDescription)
+	field("i_ni_flag_descr", a.Result.InitialFlagDescription)
+	field("deactivation_flag", a.Result.DeactivationFlag)
+	field("deactivation_flag_desc", a.Result.DeactivationFlagDescription)
+	field("firm_flag_descr", a.Result.FirmFlagDescription)
+	field("onomasia", a.Result.Onomasia)
+	field("commer_title", a.Result.CommercialTitle)
+	field("legal_status_descr", a.Result.LegalStatusDescription)
+	field("postal_address", a.Result.PostalAddress)
+	field("postal_address_no", a.Result.PostalAddressNo)
+	field("postal_zip_code", a.Result.PostalZipCode)
+	field("postal_area_description", a.Result.PostalAreaDescription)
+	field("regist_date", a.Result.RegistrationDate)
+	field("stop_date", a.Result.StopDate)
+	field("normal_vat_system_flag", a.Result.NormalVATSystemFlag)
+
+	b.WriteString("ACTIVITIES:--------------------\n")
 	for k, v := range a.Activities {
-		s += fmt.Sprintf("ACTIVITY #%d\n", k)
-		s += fmt.Sprintf("FirmActCode: %d\n", v.Code)
-		s += fmt.Sprintf("FirmActDescr: %s\n", v.Descriptionn)
-		s += fmt.Sprintf("FirmActKind: %d\n", v.Kind)
-		s += fmt.Sprintf("FirmActKindDescr: %s\n", v.KindDescr)
+		b.WriteString("ACTIVITY #")
+		b.Write(strconv.AppendInt(num[:0], int64(k), 10))
+		b.WriteByte('\n')
+		b.WriteString("FirmActCode: ")
+		b.Write(strconv.AppendInt(num[:0], int64(v.Code), 10))
+		b.WriteString("\nFirmActDescr: ")
+		b.WriteString(v.Descriptionn)
+		b.WriteString("\nFirmActKind: ")
+		b.Write(strconv.AppendInt(num[:0], int64(v.Kind), 10))
+		b.WriteString("\nFirmActKindDescr: ")
+		b.WriteString(v.KindDescr)
+		b.WriteByte('\n')
 	}
 
-	//s += fmt.Sprintf("ErrorDescr: %s\n", a.Error.Message)
-	//s += fmt.Sprintf("ErrorCode: %s\n", a.Error.Code)
-	s += fmt.Sprintf("Error: %v", a.Error)
+	// as printed with %v
+	b.WriteString("Error: ")
+	if a.Error == nil {
+		b.WriteString("<nil>")
+	} else {
+		b.WriteString("&{")
+		b.WriteString(a.Error.Code)
+		b.WriteByte(' ')
+		b.WriteString(a.Error.Message)
+		b.WriteByte('}')
+	}
 
-	return s
+	return b.String()
 }
@@ -0,0 +1,84 @@
+package rgwspublic
+
+import (
+	"strings"
+	"unicode"
+)
+
+// greek to latin letters, as in ELOT 743
+var translitLetters = map[rune]string{
+	'Α': "A", 'Β': "V", 'Γ': "G", 'Δ': "D", 'Ε': "E", 'Ζ': "Z", 'Η': "I", 'Θ': "TH",
+	'Ι': "I", 'Κ': "K", 'Λ': "L", 'Μ': "M", 'Ν': "N", 'Ξ': "X", 'Ο': "O", 'Π': "P",
+	'Ρ': "R", 'Σ': "S", 'Τ': "T", 'Υ': "Y", 'Φ': "F", 'Χ': "CH", 'Ψ': "PS", 'Ω': "O",
+	'Ά': "A", 'Έ': "E", 'Ή': "I", 'Ί': "I", 'Ϊ': "I", 'Ό': "O", 'Ύ': "Y", 'Ϋ': "Y", 'Ώ': "O",
+}
+
+// letter pairs transliterated together
+var translitPairs = map[string]string{
+	"ΟΥ": "OU", "ΟΎ": "OU", "ΌΥ": "OU",
+	"ΓΓ": "NG", "ΓΞ": "NX", "ΓΧ": "NCH",
+}
+
+// letters after which ΑΥ and ΕΥ sound as AF and EF
+const voiceless = "ΘΚΞΠΣΤΦΧΨ"
+
+// Transliterate writes greek text with latin letters, following ELOT 743
+// other characters are kept as they are, lowercase letters stay lowercase
+func Transliterate(s string) string {
+
+	rs := []rune(s)
+	upper := make([]rune, len(rs))
+	for i, r := range rs {
+		upper[i] = unicode.ToUpper(r)
+		if r == 'ς' {
+			upper[i] = 'Σ'
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(rs); i++ {
+
+		lower := unicode.IsLower(rs[i])
+		out, n := "", 1
+
+		if i+1 < len(rs) {
+			pair := string(upper[i : i+2])
+			switch {
+			case translitPairs[pair] != "":
+				out, n = translitPairs[pair], 2
+
+			case (upper[i] == 'Α' || upper[i] == 'Ε') && isUpsilon(upper[i+1]):
+				v := "V"
+				if i+2 >= len(rs) || strings.ContainsRune(voiceless, upper[i+2]) || !unicode.IsLetter(rs[i+2]) {
+					v = "F"
+				}
+				out, n = translitLetters[upper[i]]+v, 2
+			}
+		}
+
+		if out == "" {
+			l, ok := translitLetters[upper[i]]
+			if !ok {
+				b.WriteRune(rs[i])
+				continue
+			}
+			out = l
+		}
+
+		// a capital in lowercase text, e.g. Θε, becomes Th
+		switch {
+		case lower:
+			out = strings.ToLower(out)
+		case len(out) > 1 && i+1 < len(rs) && unicode.IsLower(rs[i+1]):
+			out = out[:1] + strings.ToLower(out[1:])
+		}
+		b.WriteString(out)
+		i += n - 1
+	}
+
+	return b.String()
+}
+
+func isUpsilon(r rune) bool {
+	return r == 'Υ' || r == 'Ύ'
+}
@@ -0,0 +1,163 @@
+package rgwspublic
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// UBL 2.1 namespaces of aggregate and basic components
+const (
+	UBLNamespaceCAC = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	UBLNamespaceCBC = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// PeppolSchemeGreekVAT is the electronic address scheme of a greek VAT number
+const PeppolSchemeGreekVAT = "9933"
+
+// UBLParty is a UBL 2.1 cac:Party, elements in schema order
+// it marshals with cac/cbc prefixes, declared by the enclosing document
+// or by WithNamespaces for a standalone fragment
+type UBLParty struct {
+	XMLName xml.Name `xml:"cac:Party"`
+	CAC     string   `xml:"xmlns:cac,attr,omitempty"`
+	CBC     string   `xml:"xmlns:cbc,attr,omitempty"`
+
+	EndpointID       *UBLIdentifier       `xml:"cbc:EndpointID,omitempty"`
+	PartyName        *UBLPartyName        `xml:"cac:PartyName,omitempty"`
+	PostalAddress    *UBLAddress          `xml:"cac:PostalAddress,omitempty"`
+	PartyTaxScheme   *UBLPartyTaxScheme   `xml:"cac:PartyTaxScheme,omitempty"`
+	PartyLegalEntity *UBLPartyLegalEntity `xml:"cac:PartyLegalEntity,omitempty"`
+}
+
+// UBLIdentifier is an identifier with its scheme
+type UBLIdentifier struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+// UBLPartyName is a cac:PartyName
+type UBLPartyName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+// UBLAddress is a cac:PostalAddress or cac:RegistrationAddress
+type UBLAddress struct {
+	ID         string      `xml:"cbc:ID,omitempty"`
+	StreetName string      `xml:"cbc:StreetName,omitempty"`
+	Department string      `xml:"cbc:Department,omitempty"`
+	CityName   string      `xml:"cbc:CityName,omitempty"`
+	PostalZone string      `xml:"cbc:PostalZone,omitempty"`
+	Country    *UBLCountry `xml:"cac:Country,omitempty"`
+}
+
+// UBLCountry is a cac:Country
+type UBLCountry struct {
+	IdentificationCode string `xml:"cbc:IdentificationCode"`
+}
+
+// UBLPartyTaxScheme is a cac:PartyTaxScheme
+// the tax office (ΔΟΥ) is given as the registration address
+type UBLPartyTaxScheme struct {
+	CompanyID           string       `xml:"cbc:CompanyID"`
+	RegistrationAddress *UBLAddress  `xml:"cac:RegistrationAddress,omitempty"`
+	TaxScheme           UBLTaxScheme `xml:"cac:TaxScheme"`
+}
+
+// UBLTaxScheme is a cac:TaxScheme
+type UBLTaxScheme struct {
+	ID string `xml:"cbc:ID"`
+}
+
+// UBLPartyLegalEntity is a cac:PartyLegalEntity
+type UBLPartyLegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+	CompanyID        string `xml:"cbc:CompanyID,omitempty"`
+	CompanyLegalForm string `xml:"cbc:CompanyLegalForm,omitempty"`
+}
+
+// UBLSupplierParty is a cac:AccountingSupplierParty of an invoice
+type UBLSupplierParty struct {
+	XMLName xml.Name  `xml:"cac:AccountingSupplierParty"`
+	Party   *UBLParty `xml:"cac:Party"`
+}
+
+// UBLCustomerParty is a cac:AccountingCustomerParty of an invoice
+type UBLCustomerParty struct {
+	XMLName xml.Name  `xml:"cac:AccountingCustomerParty"`
+	Party   *UBLParty `xml:"cac:Party"`
+}
+
+// NewUBLParty fills a UBL party from a record
+// the VAT identifier is EL followed by the AFM, the country is GR
+func NewUBLParty(i *VATInfo) *UBLParty {
+
+	r := i.Result
+	afm := squash(r.AFM)
+	name := squash(r.CommercialTitle)
+	if name == "" {
+		name = squash(r.Onomasia)
+	}
+
+	p := &UBLParty{
+		EndpointID: &UBLIdentifier{SchemeID: PeppolSchemeGreekVAT, Value: afm},
+		PartyName:  &UBLPartyName{Name: name},
+		PostalAddress: &UBLAddress{
+			StreetName: squash(squash(r.PostalAddress) + " " + squash(r.PostalAddressNo)),
+			CityName:   squash(r.PostalAreaDescription),
+			PostalZone: squash(r.PostalZipCode),
+			Country:    &UBLCountry{IdentificationCode: "GR"},
+		},
+		PartyTaxScheme: &UBLPartyTaxScheme{
+			CompanyID: "EL" + afm,
+			TaxScheme: UBLTaxScheme{ID: "VAT"},
+		},
+		PartyLegalEntity: &UBLPartyLegalEntity{
+			RegistrationName: squash(r.Onomasia),
+			CompanyID:        afm,
+			CompanyLegalForm: squash(r.LegalStatusDescription),
+		},
+	}
+
+	if doy := squash(r.DOY); doy != "" {
+		p.PartyTaxScheme.RegistrationAddress = &UBLAddress{
+			ID:         doy,
+			Department: squash(r.DOYDescription),
+			Country:    &UBLCountry{IdentificationCode: "GR"},
+		}
+	}
+
+	return p
+}
+
+// WithNamespaces declares the cac and cbc prefixes on the party,
+// for use as a standalone document
+func (p *UBLParty) WithNamespaces() *UBLParty {
+	p.CAC, p.CBC = UBLNamespaceCAC, UBLNamespaceCBC
+	return p
+}
+
+// AsSupplier wraps the party as cac:AccountingSupplierParty
+func (p *UBLParty) AsSupplier() *UBLSupplierParty {
+	return &UBLSupplierParty{Party: p}
+}
+
+// AsCustomer wraps the party as cac:AccountingCustomerParty
+func (p *UBLParty) AsCustomer() *UBLCustomerParty {
+	return &UBLCustomerParty{Party: p}
+}
+
+// String returns the indented xml of a standalone party
+func (p *UBLParty) String() string {
+
+	standalone := *p
+	standalone.WithNamespaces()
+
+	var b strings.Builder
+	enc := xml.NewEncoder(&b)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&standalone); err != nil {
+		return ""
+	}
+
+	return b.String()
+}
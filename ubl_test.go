@@ -0,0 +1,123 @@
+package rgwspublic
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// ublPaths decodes a document and returns each element's text by path,
+// checking every element of the party is in the UBL namespace its prefix implies
+func ublPaths(t *testing.T, doc string) map[string]string {
+
+	paths := map[string]string{}
+	var stack []string
+
+	d := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid xml: %s", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Space != UBLNamespaceCAC && tok.Name.Space != UBLNamespaceCBC && len(stack) > 0 {
+				t.Errorf("element %s not in a UBL namespace: %q", tok.Name.Local, tok.Name.Space)
+			}
+			stack = append(stack, tok.Name.Local)
+			for _, a := range tok.Attr {
+				if a.Name.Local == "schemeID" {
+					paths[strings.Join(stack, "/")+"@schemeID"] = a.Value
+				}
+			}
+		case xml.CharData:
+			if s := strings.TrimSpace(string(tok)); s != "" {
+				paths[strings.Join(stack, "/")] = s
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return paths
+}
+
+func TestUBLParty(t *testing.T) {
+
+	p := NewUBLParty(testSnapshot(t, testVATInfoResponse))
+	doc := p.String()
+
+	wanted := map[string]string{
+		"Party/EndpointID":                                                    "094014298",
+		"Party/EndpointID@schemeID":                                           "9933",
+		"Party/PartyName/Name":                                                "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ Α.Ε.",
+		"Party/PostalAddress/StreetName":                                      "ΑΜΕΡΙΚΗΣ 4",
+		"Party/PostalAddress/CityName":                                        "ΑΘΗΝΑ",
+		"Party/PostalAddress/PostalZone":                                      "10564",
+		"Party/PostalAddress/Country/IdentificationCode":                      "GR",
+		"Party/PartyTaxScheme/CompanyID":                                      "EL094014298",
+		"Party/PartyTaxScheme/RegistrationAddress/ID":                         "1159",
+		"Party/PartyTaxScheme/RegistrationAddress/Department":                 "ΦΑΕ ΑΘΗΝΩΝ",
+		"Party/PartyTaxScheme/TaxScheme/ID":                                   "VAT",
+		"Party/PartyLegalEntity/RegistrationName":                             "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ",
+		"Party/PartyLegalEntity/CompanyLegalForm":                             "ΑΕ",
+		"Party/PartyTaxScheme/RegistrationAddress/Country/IdentificationCode": "GR",
+	}
+
+	paths := ublPaths(t, doc)
+	for path, value := range wanted {
+		if paths[path] != value {
+			t.Errorf("unexpected %s, got: %q, wanted: %q", path, paths[path], value)
+		}
+	}
+
+	// elements follow the order of the UBL schema
+	order := []string{"<cbc:EndpointID", "<cac:PartyName>", "<cac:PostalAddress>", "<cac:PartyTaxScheme>", "<cac:PartyLegalEntity>"}
+	last := -1
+	for _, o := range order {
+		i := strings.Index(doc, o)
+		if i < last {
+			t.Errorf("element %s out of order", o)
+		}
+		last = i
+	}
+
+	if p.CAC != "" {
+		t.Errorf("String should not declare namespaces on the party itself")
+	}
+}
+
+func TestUBLPartyEmbedded(t *testing.T) {
+
+	type invoice struct {
+		XMLName  xml.Name          `xml:"urn:oasis:names:specification:ubl:schema:xsd:Invoice-2 Invoice"`
+		CAC      string            `xml:"xmlns:cac,attr"`
+		CBC      string            `xml:"xmlns:cbc,attr"`
+		ID       string            `xml:"cbc:ID"`
+		Supplier *UBLSupplierParty `xml:"cac:AccountingSupplierParty"`
+		Customer *UBLCustomerParty `xml:"cac:AccountingCustomerParty"`
+	}
+
+	p := NewUBLParty(testSnapshot(t, testVATInfoResponse))
+	b, err := xml.Marshal(invoice{
+		CAC:      UBLNamespaceCAC,
+		CBC:      UBLNamespaceCBC,
+		ID:       "INV-1",
+		Supplier: p.AsSupplier(),
+		Customer: p.AsCustomer(),
+	})
+	if err != nil {
+		t.Fatalf("error marshaling invoice: %s", err)
+	}
+
+	paths := ublPaths(t, string(b))
+	if paths["Invoice/AccountingSupplierParty/Party/PartyTaxScheme/CompanyID"] != "EL094014298" ||
+		paths["Invoice/AccountingCustomerParty/Party/PartyName/Name"] != "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ Α.Ε." {
+		t.Errorf("party not embedded: %s", b)
+	}
+}
@@ -0,0 +1,653 @@
+package rgwspublic
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// reasons a VAT number is rejected, wrapped by VATError
+var (
+	ErrVATCountry  = errors.New("unknown EU country prefix")
+	ErrVATFormat   = errors.New("wrong format")
+	ErrVATChecksum = errors.New("check digit mismatch")
+)
+
+// VATError tells why a VAT number is invalid
+// it matches ErrInvalidVAT with errors.Is, Err is one of the ErrVAT* errors
+type VATError struct {
+	Country string
+	Number  string
+	Reason  string
+	Err     error
+}
+
+func (e *VATError) Error() string {
+	s := "invalid VAT " + e.Country + e.Number + ": " + e.Err.Error()
+	if e.Reason != "" {
+		s += ", " + e.Reason
+	}
+	return s
+}
+
+func (e *VATError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes every VATError an ErrInvalidVAT
+func (e *VATError) Is(target error) bool {
+	return target == ErrInvalidVAT
+}
+
+// vatCheckers validate the number of each EU country, prefixed as in VIES
+// each returns ErrVATFormat or ErrVATChecksum and a reason
+var vatCheckers = map[string]func(n string) (error, string){
+	"AT": checkVATAT, "BE": checkVATBE, "BG": checkVATBG, "CY": checkVATCY,
+	"CZ": checkVATCZ, "DE": checkVATDE, "DK": checkVATDK, "EE": checkVATEE,
+	"EL": checkVATEL, "ES": checkVATES, "FI": checkVATFI, "FR": checkVATFR,
+	"HR": checkVATHR, "HU": checkVATHU, "IE": checkVATIE, "IT": checkVATIT,
+	"LT": checkVATLT, "LU": checkVATLU, "LV": checkVATLV, "MT": checkVATMT,
+	"NL": checkVATNL, "PL": checkVATPL, "PT": checkVATPT, "RO": checkVATRO,
+	"SE": checkVATSE, "SI": checkVATSI, "SK": checkVATSK, "XI": checkVATXI,
+}
+
+// ValidateVAT checks the format and check digits of an EU VAT number, offline
+// id is a number with its country prefix, GR is read as EL and a number without prefix is greek
+// returns the country, the number without prefix, spaces and punctuation, or a *VATError
+func ValidateVAT(id string) (string, string, error) {
+
+	country, number := splitTaxID(normalizeVAT(id))
+
+	check, ok := vatCheckers[country]
+	if !ok {
+		return country, number, &VATError{Country: country, Number: number, Err: ErrVATCountry}
+	}
+
+	// greek numbers of 8 digits lost their leading zero, as did old belgian ones of 9
+	if (country == "EL" && len(number) == 8) || (country == "BE" && len(number) == 9) {
+		number = "0" + number
+	}
+
+	if err, reason := check(number); err != nil {
+		return country, number, &VATError{Country: country, Number: number, Reason: reason, Err: err}
+	}
+
+	return country, number, nil
+}
+
+// validateAFM checks a greek number with ValidateVAT and returns it as sent to GSIS,
+// without prefix, spaces and punctuation
+func validateAFM(id string) (string, error) {
+
+	country, number, err := ValidateVAT(id)
+	if err != nil {
+		return number, err
+	}
+	if country != "EL" {
+		return number, &VATError{Country: country, Number: number, Reason: "not a greek number", Err: ErrVATCountry}
+	}
+
+	return number, nil
+}
+
+// normalizeVAT drops spaces and the punctuation people write numbers with
+func normalizeVAT(id string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '-', '.', ',', '/', ':':
+			return -1
+		}
+		return r
+	}, id))
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// digits converts a string of digits, which must be checked first
+func digits(s string) []int {
+	d := make([]int, len(s))
+	for i := range s {
+		d[i] = int(s[i] - '0')
+	}
+	return d
+}
+
+// weighted sums the digits of s times weights
+func weighted(s string, weights ...int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += int(s[i]-'0') * w
+	}
+	return sum
+}
+
+// luhn returns the Luhn checksum of s, 0 if s is valid
+func luhn(s string) int {
+	sum := 0
+	d := digits(s)
+	for i := range d {
+		v := d[len(d)-1-i]
+		if i%2 == 1 {
+			v *= 2
+			if v > 9 {
+				v -= 9
+			}
+		}
+		sum += v
+	}
+	return sum % 10
+}
+
+// mod1110 returns the ISO 7064 Mod 11,10 check digit of s
+func mod1110(s string) int {
+	product := 10
+	for _, d := range digits(s) {
+		sum := (d + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = 2 * sum % 11
+	}
+	return (11 - product) % 10
+}
+
+// mod9710 returns the ISO 7064 Mod 97,10 remainder of s, letters counting as 10 to 35
+func mod9710(s string) int {
+	r := 0
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			r = (r*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			r = (r*100 + int(c-'A') + 10) % 97
+		}
+	}
+	return r
+}
+
+func checkDigit(n string, i int, want int) (error, string) {
+	if int(n[i]-'0') != want {
+		return ErrVATChecksum, "check digit should be " + strconv.Itoa(want)
+	}
+	return nil, ""
+}
+
+func wrongFormat(format string) (error, string) {
+	return ErrVATFormat, "expected " + format
+}
+
+// AT: U and 8 digits, Luhn variant
+func checkVATAT(n string) (error, string) {
+	if len(n) != 9 || n[0] != 'U' || !isDigits(n[1:]) {
+		return wrongFormat("U and 8 digits")
+	}
+	return checkDigit(n, 8, (16-luhn(n[1:8]))%10)
+}
+
+// BE: 10 digits starting with 0 or 1
+func checkVATBE(n string) (error, string) {
+	if len(n) != 10 || !isDigits(n) || n[0] > '1' {
+		return wrongFormat("10 digits starting with 0 or 1")
+	}
+	v, _ := strconv.Atoi(n[:8])
+	c, _ := strconv.Atoi(n[8:])
+	if 97-v%97 != c {
+		return ErrVATChecksum, "last two digits should be " + strconv.Itoa(97-v%97)
+	}
+	return nil, ""
+}
+
+// BG: 9 digits for companies, 10 for persons, foreigners and others
+func checkVATBG(n string) (error, string) {
+	if !isDigits(n) || (len(n) != 9 && len(n) != 10) {
+		return wrongFormat("9 or 10 digits")
+	}
+
+	if len(n) == 9 {
+		c := weighted(n, 1, 2, 3, 4, 5, 6, 7, 8) % 11
+		if c == 10 {
+			c = weighted(n, 3, 4, 5, 6, 7, 8, 9, 10) % 11
+		}
+		return checkDigit(n, 8, c%10)
+	}
+
+	// civil number (ЕГН), foreigner number (ЛНЧ) or other
+	egn := weighted(n, 2, 4, 8, 5, 10, 9, 7, 3, 6) % 11 % 10
+	pnf := weighted(n, 21, 19, 17, 13, 11, 9, 7, 3, 1) % 10
+	other := (11 - weighted(n, 4, 3, 2, 7, 6, 5, 4, 3, 2)%11) % 11 % 10
+	last := int(n[9] - '0')
+	if last != egn && last != pnf && last != other {
+		return ErrVATChecksum, "no check digit scheme matches"
+	}
+	return nil, ""
+}
+
+// CY: 8 digits and a check letter, not starting with 12
+func checkVATCY(n string) (error, string) {
+	if len(n) != 9 || !isDigits(n[:8]) || n[8] < 'A' || n[8] > 'Z' {
+		return wrongFormat("8 digits and a letter")
+	}
+	if strings.HasPrefix(n, "12") {
+		return ErrVATFormat, "numbers starting with 12 are not issued"
+	}
+	odd := []int{1, 0, 5, 7, 9, 13, 15, 17, 19, 21}
+	sum := 0
+	for i, d := range digits(n[:8]) {
+		if i%2 == 0 {
+			sum += odd[d]
+		} else {
+			sum += d
+		}
+	}
+	if want := byte('A' + sum%26); n[8] != want {
+		return ErrVATChecksum, "check letter should be " + string(want)
+	}
+	return nil, ""
+}
+
+// CZ: 8 digits for companies, 9 or 10 for persons
+func checkVATCZ(n string) (error, string) {
+	if !isDigits(n) || len(n) < 8 || len(n) > 10 {
+		return wrongFormat("8 to 10 digits")
+	}
+
+	switch len(n) {
+	case 8:
+		if n[0] == '9' {
+			return ErrVATFormat, "company numbers don't start with 9"
+		}
+		c := (11 - weighted(n, 8, 7, 6, 5, 4, 3, 2)%11) % 11
+		if c == 0 {
+			c = 1
+		}
+		return checkDigit(n, 7, c%10)
+	case 10:
+		// birth numbers divide by 11, or end in 0 when the rest leaves 10
+		v, _ := strconv.ParseInt(n, 10, 64)
+		h, _ := strconv.ParseInt(n[:9], 10, 64)
+		if v%11 != 0 && !(h%11 == 10 && n[9] == '0') {
+			return ErrVATChecksum, "birth number doesn't divide by 11"
+		}
+	}
+
+	// birth numbers from before 1954 have 9 digits and no check digit
+	return nil, ""
+}
+
+// DE: 9 digits, ISO 7064 Mod 11,10
+func checkVATDE(n string) (error, string) {
+	if len(n) != 9 || !isDigits(n) || n[0] == '0' {
+		return wrongFormat("9 digits not starting with 0")
+	}
+	return checkDigit(n, 8, mod1110(n[:8]))
+}
+
+// DK: 8 digits, weighted sum divisible by 11
+func checkVATDK(n string) (error, string) {
+	if len(n) != 8 || !isDigits(n) || n[0] == '0' {
+		return wrongFormat("8 digits not starting with 0")
+	}
+	if weighted(n, 2, 7, 6, 5, 4, 3, 2, 1)%11 != 0 {
+		return ErrVATChecksum, "weighted sum doesn't divide by 11"
+	}
+	return nil, ""
+}
+
+// EE: 9 digits starting with 10
+func checkVATEE(n string) (error, string) {
+	if len(n) != 9 || !isDigits(n) || !strings.HasPrefix(n, "10") {
+		return wrongFormat("9 digits starting with 10")
+	}
+	return checkDigit(n, 8, (10-weighted(n, 3, 7, 1, 3, 7, 1, 3, 7)%10)%10)
+}
+
+// EL: 9 digits, powers of 2 modulo 11
+func checkVATEL(n string) (error, string) {
+	if len(n) != 9 || !isDigits(n) {
+		return wrongFormat("9 digits")
+	}
+	return checkDigit(n, 8, weighted(n, 256, 128, 64, 32, 16, 8, 4, 2)%11%10)
+}
+
+// ES: NIF of persons and foreigners, or CIF of companies
+func checkVATES(n string) (error, string) {
+	if len(n) != 9 || !isDigits(n[1:8]) {
+		return wrongFormat("a letter or digit, 7 digits and a check character")
+	}
+
+	const letters = "TRWAGMYFPDXBNJZSQVHLCKE"
+	first, last := n[0], n[8]
+
+	switch {
+	case first >= '0' && first <= '9', first == 'X', first == 'Y', first == 'Z', first == 'K', first == 'L', first == 'M':
+		// DNI/NIE, the check letter is the number modulo 23
+		num := n[:8]
+		switch first {
+		case 'X', 'K', 'L', 'M':
+			num = "0" + n[1:8]
+		case 'Y':
+			num = "1" + n[1:8]
+		case 'Z':
+			num = "2" + n[1:8]
+		}
+		v, _ := strconv.Atoi(num)
+		if want := letters[v%23]; last != want {
+			return ErrVATChecksum, "check letter should be " + string(want)
+		}
+		return nil, ""
+
+	case strings.IndexByte("ABCDEFGHJNPQRSUVW", first) >= 0:
+		// CIF, Luhn-like over the 7 digits
+		sum := 0
+		for i, d := range digits(n[1:8]) {
+			if i%2 == 0 {
+				d *= 2
+				d = d/10 + d%10
+			}
+			sum += d
+		}
+		c := (10 - sum%10) % 10
+		digit, letter := byte('0'+c), "JABCDEFGHI"[c]
+
+		switch {
+		case strings.IndexByte("NPQRSW", first) >= 0:
+			if last != letter {
+				return ErrVATChecksum, "check letter should be " + string(letter)
+			}
+		case strings.IndexByte("ABEH", first) >= 0:
+			if last != digit {
+				return ErrVATChecksum, "check digit should be " + string(digit)
+			}
+		default:
+			if last != digit && last != letter {
+				return ErrVATChecksum, "check character should be " + string(digit) + " or " + string(letter)
+			}
+		}
+		return nil, ""
+	}
+
+	return ErrVATFormat, "unknown first character " + string(first)
+}
+
+// FI: 8 digits, weighted sum divisible by 11
+func checkVATFI(n string) (error, string) {
+	if len(n) != 8 || !isDigits(n) {
+		return wrongFormat("8 digits")
+	}
+	if weighted(n, 7, 9, 10, 5, 8, 4, 2, 1)%11 != 0 {
+		return ErrVATChecksum, "weighted sum doesn't divide by 11"
+	}
+	return nil, ""
+}
+
+// FR: a 2 character key and the 9 digit SIREN
+// only numeric keys can be checked, letters are used by newer numbers
+func checkVATFR(n string) (error, string) {
+	if len(n) != 11 || !isDigits(n[2:]) || strings.ContainsAny(n[:2], "IO") {
+		return wrongFormat("a 2 character key and 9 digits")
+	}
+	// SIRENs of Monaco start with 000 and are not Luhn numbers
+	if n[2:5] != "000" && luhn(n[2:]) != 0 {
+		return ErrVATChecksum, "SIREN fails the Luhn check"
+	}
+	if isDigits(n[:2]) {
+		siren, _ := strconv.Atoi(n[2:])
+		key, _ := strconv.Atoi(n[:2])
+		if want := (12 + 3*(siren%97)) % 97; key != want {
+			return ErrVATChecksum, "key should be " + strconv.Itoa(want)
+		}
+	}
+	return nil, ""
+}
+
+// HR: 11 digits, ISO 7064 Mod 11,10
+func checkVATHR(n string) (error, string) {
+	if len(n) != 11 || !isDigits(n) {
+		return wrongFormat("11 digits")
+	}
+	return checkDigit(n, 10, mod1110(n[:10]))
+}
+
+// HU: 8 digits
+func checkVATHU(n string) (error, string) {
+	if len(n) != 8 || !isDigits(n) {
+		return wrongFormat("8 digits")
+	}
+	if weighted(n, 9, 7, 3, 1, 9, 7, 3, 1)%10 != 0 {
+		return ErrVATChecksum, "weighted sum doesn't divide by 10"
+	}
+	return nil, ""
+}
+
+// IE: 7 digits, a check letter and an optional letter, or the old format
+func checkVATIE(n string) (error, string) {
+
+	// old format, digit, letter or symbol, 5 digits and check letter
+	if len(n) == 8 && isDigits(n[:1]) && !isDigits(n[1:2]) && isDigits(n[2:7]) {
+		n = "0" + n[2:7] + n[:1] + n[7:]
+	}
+
+	if (len(n) != 8 && len(n) != 9) || !isDigits(n[:7]) || n[7] < 'A' || n[7] > 'W' {
+		return wrongFormat("7 digits and 1 or 2 letters")
+	}
+
+	const alphabet = "WABCDEFGHIJKLMNOPQRSTUV"
+	sum := weighted(n, 8, 7, 6, 5, 4, 3, 2)
+	if len(n) == 9 {
+		i := strings.IndexByte(alphabet, n[8])
+		if i < 0 {
+			return wrongFormat("7 digits and 1 or 2 letters")
+		}
+		sum += 9 * i
+	}
+	if want := alphabet[sum%23]; n[7] != want {
+		return ErrVATChecksum, "check letter should be " + string(want)
+	}
+	return nil, ""
+}
+
+// IT: 11 digits, Luhn, with a valid province office code
+func checkVATIT(n string) (error, string) {
+	if len(n) != 11 || !isDigits(n) {
+		return wrongFormat("11 digits")
+	}
+	if n[:7] == "0000000" {
+		return ErrVATFormat, "company number is zero"
+	}
+	office, _ := strconv.Atoi(n[7:10])
+	if (office < 1 || office > 100) && office != 120 && office != 121 && office != 888 && office != 999 {
+		return ErrVATFormat, "unknown office code " + n[7:10]
+	}
+	if luhn(n) != 0 {
+		return ErrVATChecksum, "Luhn check fails"
+	}
+	return nil, ""
+}
+
+// LT: 9 digits for companies or 12 for temporary registrations
+func checkVATLT(n string) (error, string) {
+	if !isDigits(n) || (len(n) != 9 && len(n) != 12) || n[len(n)-2] != '1' {
+		return wrongFormat("9 or 12 digits, 1 before the check digit")
+	}
+	body := n[:len(n)-1]
+	sum := 0
+	for i, d := range digits(body) {
+		sum += (1 + i%9) * d
+	}
+	c := sum % 11
+	if c == 10 {
+		sum = 0
+		for i, d := range digits(body) {
+			sum += (1 + (i+2)%9) * d
+		}
+		c = sum % 11
+	}
+	return checkDigit(n, len(n)-1, c%10)
+}
+
+// LU: 8 digits, the first 6 modulo 89
+func checkVATLU(n string) (error, string) {
+	if len(n) != 8 || !isDigits(n) {
+		return wrongFormat("8 digits")
+	}
+	v, _ := strconv.Atoi(n[:6])
+	c, _ := strconv.Atoi(n[6:])
+	if v%89 != c {
+		return ErrVATChecksum, "last two digits should be " + strconv.Itoa(v%89)
+	}
+	return nil, ""
+}
+
+// LV: 11 digits, companies start above 3, persons with their birth date
+func checkVATLV(n string) (error, string) {
+	if len(n) != 11 || !isDigits(n) {
+		return wrongFormat("11 digits")
+	}
+
+	if n[0] > '3' {
+		if weighted(n, 9, 1, 4, 8, 3, 10, 2, 5, 7, 6, 1)%11 != 3 {
+			return ErrVATChecksum, "weighted sum modulo 11 should be 3"
+		}
+		return nil, ""
+	}
+
+	// personal codes issued since 2017 start with 32 and have no check digit
+	if strings.HasPrefix(n, "32") {
+		return nil, ""
+	}
+
+	c := (1101 - weighted(n, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2)) % 11
+	if c == 10 {
+		return ErrVATChecksum, "personal code has no valid check digit"
+	}
+	return checkDigit(n, 10, c)
+}
+
+// MT: 8 digits, weighted sum divisible by 37
+func checkVATMT(n string) (error, string) {
+	if len(n) != 8 || !isDigits(n) || n[0] == '0' {
+		return wrongFormat("8 digits not starting with 0")
+	}
+	if weighted(n, 3, 4, 6, 7, 8, 9, 10, 1)%37 != 0 {
+		return ErrVATChecksum, "weighted sum doesn't divide by 37"
+	}
+	return nil, ""
+}
+
+// NL: 9 digits, B and 2 digits, checked as a BSN or with ISO 7064 Mod 97,10
+func checkVATNL(n string) (error, string) {
+	if len(n) != 12 || !isDigits(n[:9]) || n[9] != 'B' || !isDigits(n[10:]) {
+		return wrongFormat("9 digits, B and 2 digits")
+	}
+	if n[:9] == "000000000" {
+		return ErrVATFormat, "number is zero"
+	}
+	bsn := weighted(n, 9, 8, 7, 6, 5, 4, 3, 2) - int(n[8]-'0')
+	if bsn%11 != 0 && mod9710("NL"+n) != 1 {
+		return ErrVATChecksum, "neither the BSN nor the Mod 97 check passes"
+	}
+	return nil, ""
+}
+
+// PL: 10 digits
+func checkVATPL(n string) (error, string) {
+	if len(n) != 10 || !isDigits(n) {
+		return wrongFormat("10 digits")
+	}
+	c := weighted(n, 6, 5, 7, 2, 3, 4, 5, 6, 7) % 11
+	if c == 10 {
+		return ErrVATChecksum, "number has no valid check digit"
+	}
+	return checkDigit(n, 9, c)
+}
+
+// PT: 9 digits not starting with 0
+func checkVATPT(n string) (error, string) {
+	if len(n) != 9 || !isDigits(n) || n[0] == '0' {
+		return wrongFormat("9 digits not starting with 0")
+	}
+	return checkDigit(n, 8, (11-weighted(n, 9, 8, 7, 6, 5, 4, 3, 2)%11)%11%10)
+}
+
+// RO: 2 to 10 digits for companies, or the 13 digit personal code
+func checkVATRO(n string) (error, string) {
+	if !isDigits(n) || n[0] == '0' || len(n) < 2 || (len(n) > 10 && len(n) != 13) {
+		return wrongFormat("2 to 10 digits not starting with 0, or 13 digits")
+	}
+
+	if len(n) == 13 {
+		c := weighted(n, 2, 7, 9, 1, 4, 6, 3, 5, 8, 2, 7, 9) % 11
+		if c == 10 {
+			c = 1
+		}
+		return checkDigit(n, 12, c)
+	}
+
+	body := strings.Repeat("0", 10-len(n)) + n
+	c := 10 * weighted(body, 7, 5, 3, 2, 1, 7, 5, 3, 2) % 11 % 10
+	return checkDigit(n, len(n)-1, c)
+}
+
+// SE: 10 digit organisation number, Luhn, and 01
+func checkVATSE(n string) (error, string) {
+	if len(n) != 12 || !isDigits(n) || !strings.HasSuffix(n, "01") {
+		return wrongFormat("12 digits ending in 01")
+	}
+	if luhn(n[:10]) != 0 {
+		return ErrVATChecksum, "Luhn check fails"
+	}
+	return nil, ""
+}
+
+// SI: 8 digits not starting with 0
+func checkVATSI(n string) (error, string) {
+	if len(n) != 8 || !isDigits(n) || n[0] == '0' {
+		return wrongFormat("8 digits not starting with 0")
+	}
+	return checkDigit(n, 7, (11-weighted(n, 8, 7, 6, 5, 4, 3, 2)%11)%10)
+}
+
+// SK: 10 digits divisible by 11
+func checkVATSK(n string) (error, string) {
+	if len(n) != 10 || !isDigits(n) || n[0] == '0' || strings.IndexByte("234789", n[2]) < 0 {
+		return wrongFormat("10 digits, the third one 2, 3, 4, 7, 8 or 9")
+	}
+	v, _ := strconv.ParseInt(n, 10, 64)
+	if v%11 != 0 {
+		return ErrVATChecksum, "number doesn't divide by 11"
+	}
+	return nil, ""
+}
+
+// XI: Northern Ireland, as GB numbers of 9 digits, 12 with a branch,
+// or GD and HA for government departments and health authorities
+func checkVATXI(n string) (error, string) {
+
+	switch {
+	case len(n) == 5 && strings.HasPrefix(n, "GD") && isDigits(n[2:]):
+		if v, _ := strconv.Atoi(n[2:]); v >= 500 {
+			return ErrVATFormat, "government department numbers are below 500"
+		}
+		return nil, ""
+	case len(n) == 5 && strings.HasPrefix(n, "HA") && isDigits(n[2:]):
+		if v, _ := strconv.Atoi(n[2:]); v < 500 {
+			return ErrVATFormat, "health authority numbers are 500 or above"
+		}
+		return nil, ""
+	case (len(n) != 9 && len(n) != 12) || !isDigits(n):
+		return wrongFormat("9 or 12 digits, or GD/HA and 3 digits")
+	}
+
+	sum := weighted(n, 8, 7, 6, 5, 4, 3, 2, 10, 1)
+	if sum%97 != 0 && (sum+55)%97 != 0 {
+		return ErrVATChecksum, "weighted sum fails both modulo 97 checks"
+	}
+	return nil, ""
+}
@@ -0,0 +1,131 @@
+package rgwspublic
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestValidateVAT(t *testing.T) {
+
+	valid := map[string]string{
+		"ATU13585627":       "U13585627",
+		"BE403019261":       "0403019261",
+		"BG 175 074 752":    "175074752",
+		"CY-10259033P":      "10259033P",
+		"CZ 25123891":       "25123891",
+		"DE 136,695 976":    "136695976",
+		"DK 13 58 56 28":    "13585628",
+		"EE 100 931 558":    "100931558",
+		"EL 094014298":      "094014298",
+		"GR094259216":       "094259216",
+		"94014298":          "094014298",
+		"ES A13 585 625":    "A13585625",
+		"ES B-58378431":     "B58378431",
+		"ES 54362315K":      "54362315K",
+		"ES X2482300W":      "X2482300W",
+		"FI 20774740":       "20774740",
+		"FR 40 303 265 045": "40303265045",
+		"FR 23 334 175 221": "23334175221",
+		"FRK7399859412":     "K7399859412",
+		"HR 33392005961":    "33392005961",
+		"HU-12892312":       "12892312",
+		"IE 6433435F":       "6433435F",
+		"IE 6433435OA":      "6433435OA",
+		"IE 8D79739I":       "8D79739I",
+		"IT 00743110157":    "00743110157",
+		"LT 119511515":      "119511515",
+		"LT 100001919017":   "100001919017",
+		"LU 150 274 42":     "15027442",
+		"LV 4000 3521 600":  "40003521600",
+		"LV 161175-19997":   "16117519997",
+		"MT 1167-9112":      "11679112",
+		"NL004495445B01":    "004495445B01",
+		"NL 000099998B57":   "000099998B57",
+		"PL 8567346215":     "8567346215",
+		"PT 501 964 843":    "501964843",
+		"RO 185 472 90":     "18547290",
+		"SE 123456789701":   "123456789701",
+		"SI 5022 3054":      "50223054",
+		"SK 202 274 96 19":  "2022749619",
+		"XI 980780684":      "980780684",
+		"XIGD001":           "GD001",
+	}
+
+	for id, wanted := range valid {
+		_, number, err := ValidateVAT(id)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", id, err)
+			continue
+		}
+		if number != wanted {
+			t.Errorf("%s: normalized to %s, wanted: %s", id, number, wanted)
+		}
+	}
+
+	invalid := map[string]error{
+		"EL094014299":   ErrVATChecksum,
+		"EL09401429":    ErrVATChecksum,
+		"EL0940142981":  ErrVATFormat,
+		"DE136695977":   ErrVATChecksum,
+		"DE036695976":   ErrVATFormat,
+		"FR41303265045": ErrVATChecksum,
+		"IT00743110158": ErrVATChecksum,
+		"ES A13585626":  ErrVATChecksum,
+		"ES54362315A":   ErrVATChecksum,
+		"US123456789":   ErrVATCountry,
+		"CY12000000C":   ErrVATFormat,
+	}
+
+	for id, wanted := range invalid {
+		_, _, err := ValidateVAT(id)
+		if !errors.Is(err, wanted) || !errors.Is(err, ErrInvalidVAT) {
+			t.Errorf("%s: unexpected error, got: %v, wanted: %v", id, err, wanted)
+		}
+	}
+
+	country, _, err := ValidateVAT("DE 136695977")
+	var verr *VATError
+	if !errors.As(err, &verr) || country != "DE" || verr.Reason != "check digit should be 6" {
+		t.Errorf("unexpected error reason: %v", err)
+	}
+}
+
+func TestClientRejectsInvalidVAT(t *testing.T) {
+
+	calls := 0
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		respond(testVATInfoResponse)(w, r)
+	}
+	c := newTestClient(t, h)
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	v := newTestVIESClient(t, h)
+
+	checks := map[string]func() error{
+		"lookup":           func() error { _, err := c.Lookup("", "094014299"); return err },
+		"lookup for":       func() error { _, err := c.LookupFor("maria", "onboarding", "", "12345678901"); return err },
+		"called by":        func() error { _, err := c.Lookup("094014299", "094014298"); return err },
+		"foreign":          func() error { _, err := c.Lookup("", "DE136695976"); return err },
+		"check vat":        func() error { _, err := v.CheckVat("DE", "123456789"); return err },
+		"check vat approx": func() error { _, err := v.CheckVatApprox(VIESApproxRequest{VATNumber: "EL094014299"}); return err },
+		"requester": func() error {
+			_, err := v.CheckVatApprox(VIESApproxRequest{VATNumber: "EL094014298", RequesterCountryCode: "DE", RequesterVATNumber: "123456789"})
+			return err
+		},
+	}
+
+	for name, check := range checks {
+		if err := check(); !errors.Is(err, ErrInvalidVAT) {
+			t.Errorf("%s: expected an invalid VAT error, got: %v", name, err)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("invalid numbers reached the service: %d calls", calls)
+	}
+
+	// valid numbers are sent without prefix or spaces
+	if _, err := c.Lookup("", "EL 094 014 298"); err != nil || calls != 1 {
+		t.Errorf("valid number not looked up: %v", err)
+	}
+}
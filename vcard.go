@@ -0,0 +1,107 @@
+package rgwspublic
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// VCardOptions configure WriteVCard
+type VCardOptions struct {
+	// Transliterate adds the names in latin letters, as alternates of the greek ones
+	Transliterate bool
+}
+
+// maximum octets of a vCard line before folding, RFC 6350 section 3.2
+const vcardLineLength = 75
+
+// WriteVCard writes a vCard 4.0 (RFC 6350) for each record
+// ORG is the name, ADR the postal address and NOTE holds AFM and ΔΟΥ
+func WriteVCard(w io.Writer, opts VCardOptions, infos ...*VATInfo) error {
+
+	bw := bufio.NewWriter(w)
+	for _, i := range infos {
+		for _, line := range vcardLines(i, opts) {
+			writeFolded(bw, line)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func vcardLines(i *VATInfo, opts VCardOptions) []string {
+
+	r := i.Result
+	name := squash(r.Onomasia)
+	title := squash(r.CommercialTitle)
+	fn := name
+	if title != "" {
+		fn = title
+	}
+
+	org := vcardEscape(name)
+	if title != "" && title != name {
+		org += ";" + vcardEscape(title)
+	}
+
+	lines := []string{"BEGIN:VCARD", "VERSION:4.0", "KIND:org"}
+
+	if opts.Transliterate {
+		lines = append(lines,
+			"FN;ALTID=1;LANGUAGE=el:"+vcardEscape(fn),
+			"FN;ALTID=1;LANGUAGE=el-Latn:"+vcardEscape(Transliterate(fn)),
+			"ORG;ALTID=1;LANGUAGE=el:"+org,
+			"ORG;ALTID=1;LANGUAGE=el-Latn:"+vcardEscape(Transliterate(name)),
+		)
+	} else {
+		lines = append(lines, "FN:"+vcardEscape(fn), "ORG:"+org)
+	}
+
+	street := squash(squash(r.PostalAddress) + " " + squash(r.PostalAddressNo))
+	if street != "" || squash(r.PostalZipCode) != "" || squash(r.PostalAreaDescription) != "" {
+		// post office box; extended address; street; locality; region; postal code; country
+		adr := []string{"", "", street, squash(r.PostalAreaDescription), "", squash(r.PostalZipCode), "ΕΛΛΑΔΑ"}
+		for k := range adr {
+			adr[k] = vcardEscape(adr[k])
+		}
+		lines = append(lines, "ADR;TYPE=work:"+strings.Join(adr, ";"))
+	}
+
+	note := "ΑΦΜ: " + squash(r.AFM)
+	if doy := squash(squash(r.DOY) + " " + squash(r.DOYDescription)); doy != "" {
+		note += "\nΔΟΥ: " + doy
+	}
+	lines = append(lines, "NOTE:"+vcardEscape(note), "END:VCARD")
+
+	return lines
+}
+
+// vcardEscape escapes a text value, RFC 6350 section 3.4
+func vcardEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`).Replace(s)
+}
+
+// writeFolded writes a content line ending in CRLF, folded at 75 octets
+// without splitting a multi-byte character
+func writeFolded(w *bufio.Writer, line string) {
+
+	limit := vcardLineLength
+	for len(line) > limit {
+
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+
+		// the leading space of a continuation counts
+		limit = vcardLineLength - 1
+	}
+
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
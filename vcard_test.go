@@ -0,0 +1,65 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestVCard(t *testing.T) {
+
+	i := testSnapshot(t, testVATInfoResponse)
+
+	var buf bytes.Buffer
+	if err := WriteVCard(&buf, VCardOptions{Transliterate: true}, i, i); err != nil {
+		t.Fatalf("error writing vcard: %s", err)
+	}
+	out := buf.String()
+
+	if strings.Count(out, "BEGIN:VCARD\r\n") != 2 {
+		t.Errorf("expected two cards")
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("folding split a character: %q", line)
+		}
+	}
+
+	// unfold and check the content lines
+	unfolded := strings.Replace(out, "\r\n ", "", -1)
+	wanted := []string{
+		"VERSION:4.0",
+		"FN;ALTID=1;LANGUAGE=el:ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ Α.Ε.",
+		"ORG;ALTID=1;LANGUAGE=el:ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ;ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ Α.Ε.",
+		"ORG;ALTID=1;LANGUAGE=el-Latn:TRAPEZA PEIRAIOS ANONYMI ETAIREIA",
+		"ADR;TYPE=work:;;ΑΜΕΡΙΚΗΣ 4;ΑΘΗΝΑ;;10564;ΕΛΛΑΔΑ",
+		`NOTE:ΑΦΜ: 094014298\nΔΟΥ: 1159 ΦΑΕ ΑΘΗΝΩΝ`,
+	}
+	for _, w := range wanted {
+		if !strings.Contains(unfolded, w+"\r\n") {
+			t.Errorf("missing line: %s", w)
+		}
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+
+	tests := map[string]string{
+		"ΠΑΠΑΔΟΠΟΥΛΟΣ":  "PAPADOPOULOS",
+		"Ευάγγελος":     "Evangelos",
+		"ΑΥΤΟΚΙΝΗΤΑ":    "AFTOKINITA",
+		"ΘΕΣΣΑΛΟΝΙΚΗ":   "THESSALONIKI",
+		"Ψυχή 2021 Α.Ε": "Psychi 2021 A.E",
+	}
+
+	for in, wanted := range tests {
+		if got := Transliterate(in); got != wanted {
+			t.Errorf("transliterate %s, got: %s, wanted: %s", in, got, wanted)
+		}
+	}
+}
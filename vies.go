@@ -0,0 +1,359 @@
+package rgwspublic
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VIESEndpoint is the url of the EU VIES checkVat service
+const VIESEndpoint = "https://ec.europa.eu/taxation_customs/vies/services/checkVatService"
+
+// operation names of VIES calls
+const (
+	OpCheckVat       = "check_vat"
+	OpCheckVatApprox = "check_vat_approx"
+)
+
+// errors of VIES faults, wrapped by VIESError
+var (
+	ErrVIESInvalidInput       = errors.New("vies: invalid country code or vat number")
+	ErrVIESInvalidRequester   = errors.New("vies: invalid requester info")
+	ErrVIESServiceUnavailable = errors.New("vies: service unavailable")
+	ErrVIESMSUnavailable      = errors.New("vies: member state service unavailable")
+	ErrVIESTimeout            = errors.New("vies: member state service timed out")
+	ErrVIESConcurrentLimit    = errors.New("vies: too many concurrent requests")
+	ErrVIESBlocked            = errors.New("vies: requests blocked")
+)
+
+// fault strings returned by VIES
+var viesFaults = map[string]error{
+	"INVALID_INPUT":                  ErrVIESInvalidInput,
+	"INVALID_REQUESTER_INFO":         ErrVIESInvalidRequester,
+	"SERVICE_UNAVAILABLE":            ErrVIESServiceUnavailable,
+	"MS_UNAVAILABLE":                 ErrVIESMSUnavailable,
+	"TIMEOUT":                        ErrVIESTimeout,
+	"GLOBAL_MAX_CONCURRENT_REQ":      ErrVIESConcurrentLimit,
+	"GLOBAL_MAX_CONCURRENT_REQ_TIME": ErrVIESConcurrentLimit,
+	"MS_MAX_CONCURRENT_REQ":          ErrVIESConcurrentLimit,
+	"MS_MAX_CONCURRENT_REQ_TIME":     ErrVIESConcurrentLimit,
+	"VAT_BLOCKED":                    ErrVIESBlocked,
+	"IP_BLOCKED":                     ErrVIESBlocked,
+}
+
+// errNoCountry fails a number without a country before asking VIES
+var errNoCountry = &VIESError{Code: "INVALID_INPUT", Message: "no country code", Err: ErrVIESInvalidInput}
+
+// VIESError is a fault returned by VIES
+// Err is one of the ErrVIES* errors, nil for an unknown fault
+type VIESError struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *VIESError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error() + " (" + e.Code + ")"
+	}
+	return "vies: " + e.Code
+}
+
+func (e *VIESError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the same request may succeed later
+func (e *VIESError) Temporary() bool {
+	switch e.Err {
+	case ErrVIESServiceUnavailable, ErrVIESMSUnavailable, ErrVIESTimeout, ErrVIESConcurrentLimit:
+		return true
+	}
+	return false
+}
+
+// VIESResult is the answer of checkVat or checkVatApprox
+// name and address are empty when the member state doesn't disclose them
+type VIESResult struct {
+	CountryCode       string `json:"country_code"`
+	VATNumber         string `json:"vat_number"`
+	RequestDate       string `json:"request_date"`
+	Valid             bool   `json:"valid"`
+	Name              string `json:"name"`
+	Address           string `json:"address"`
+	RequestIdentifier string `json:"request_identifier,omitempty"` // checkVatApprox only
+
+	// trader details and how they matched, checkVatApprox only
+	// a match is 1=VALID, 2=INVALID or 3=NOT_PROCESSED
+	CompanyType      string `json:"company_type,omitempty"`
+	Street           string `json:"street,omitempty"`
+	Postcode         string `json:"postcode,omitempty"`
+	City             string `json:"city,omitempty"`
+	NameMatch        string `json:"name_match,omitempty"`
+	CompanyTypeMatch string `json:"company_type_match,omitempty"`
+	StreetMatch      string `json:"street_match,omitempty"`
+	PostcodeMatch    string `json:"postcode_match,omitempty"`
+	CityMatch        string `json:"city_match,omitempty"`
+}
+
+// VIESApproxRequest is the input of checkVatApprox
+// the requester is the EU VAT number asking, needed to get a request identifier
+type VIESApproxRequest struct {
+	CountryCode          string
+	VATNumber            string
+	TraderName           string
+	TraderCompanyType    string
+	TraderStreet         string
+	TraderPostcode       string
+	TraderCity           string
+	RequesterCountryCode string
+	RequesterVATNumber   string
+}
+
+type viesEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Check *struct {
+			CountryCode string `xml:"countryCode"`
+			VATNumber   string `xml:"vatNumber"`
+			RequestDate string `xml:"requestDate"`
+			Valid       bool   `xml:"valid"`
+			Name        string `xml:"name"`
+			Address     string `xml:"address"`
+		} `xml:"checkVatResponse"`
+		Approx *struct {
+			CountryCode       string `xml:"countryCode"`
+			VATNumber         string `xml:"vatNumber"`
+			RequestDate       string `xml:"requestDate"`
+			Valid             bool   `xml:"valid"`
+			Name              string `xml:"traderName"`
+			CompanyType       string `xml:"traderCompanyType"`
+			Address           string `xml:"traderAddress"`
+			Street            string `xml:"traderStreet"`
+			Postcode          string `xml:"traderPostcode"`
+			City              string `xml:"traderCity"`
+			NameMatch         string `xml:"traderNameMatch"`
+			CompanyTypeMatch  string `xml:"traderCompanyTypeMatch"`
+			StreetMatch       string `xml:"traderStreetMatch"`
+			PostcodeMatch     string `xml:"traderPostcodeMatch"`
+			CityMatch         string `xml:"traderCityMatch"`
+			RequestIdentifier string `xml:"requestIdentifier"`
+		} `xml:"checkVatApproxResponse"`
+		Fault *struct {
+			Code   string `xml:"faultcode"`
+			String string `xml:"faultstring"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+func (c *Client) viesEndpoint() string {
+	if c.VIESEndpoint == "" {
+		return VIESEndpoint
+	}
+	return c.VIESEndpoint
+}
+
+// CheckVat asks VIES whether an EU VAT number is valid
+// accepts a country code, GR is sent as EL, and the number with or without its prefix
+// without a country code the number must start with one
+// numbers failing ValidateVAT are rejected without a call
+func (c *Client) CheckVat(country, number string) (*VIESResult, error) {
+
+	country, number = viesNumber(country, number)
+	if country == "" {
+		return nil, c.onError(errNoCountry)
+	}
+	country, number, err := ValidateVAT(country + number)
+	if err != nil {
+		return nil, c.onError(err)
+	}
+
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+		<soapenv:Envelope
+			xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"
+			xmlns:urn="urn:ec.europa.eu:taxud:vies:services:checkVat:types">
+			<soapenv:Header/>
+			<soapenv:Body>
+				<urn:checkVat>
+					<urn:countryCode>%s</urn:countryCode>
+					<urn:vatNumber>%s</urn:vatNumber>
+				</urn:checkVat>
+			</soapenv:Body>
+		</soapenv:Envelope>`, xmlEscape(country), xmlEscape(number))
+
+	env, err := c.callVIES(OpCheckVat, country+number, body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := env.Body.Check
+	if r == nil {
+		return nil, c.onError(errors.New("vies: empty checkVat response"))
+	}
+
+	return &VIESResult{
+		CountryCode: r.CountryCode,
+		VATNumber:   r.VATNumber,
+		RequestDate: r.RequestDate,
+		Valid:       r.Valid,
+		Name:        viesValue(r.Name),
+		Address:     viesValue(r.Address),
+	}, nil
+}
+
+// CheckVatApprox asks VIES whether an EU VAT number is valid and how the trader details match
+// the request identifier is returned when a requester is given, numbers failing ValidateVAT are rejected without a call
+func (c *Client) CheckVatApprox(req VIESApproxRequest) (*VIESResult, error) {
+
+	country, number := viesNumber(req.CountryCode, req.VATNumber)
+	if country == "" {
+		return nil, c.onError(errNoCountry)
+	}
+	country, number, err := ValidateVAT(country + number)
+	if err != nil {
+		return nil, c.onError(err)
+	}
+	rcountry, rnumber := req.RequesterCountryCode, req.RequesterVATNumber
+	if rnumber != "" {
+		rcountry, rnumber = viesNumber(rcountry, rnumber)
+		if rcountry == "" {
+			return nil, c.onError(errNoCountry)
+		}
+		if rcountry, rnumber, err = ValidateVAT(rcountry + rnumber); err != nil {
+			return nil, c.onError(err)
+		}
+	}
+
+	var fields bytes.Buffer
+	for _, f := range [][2]string{
+		{"countryCode", country},
+		{"vatNumber", number},
+		{"traderName", req.TraderName},
+		{"traderCompanyType", req.TraderCompanyType},
+		{"traderStreet", req.TraderStreet},
+		{"traderPostcode", req.TraderPostcode},
+		{"traderCity", req.TraderCity},
+		{"requesterCountryCode", rcountry},
+		{"requesterVatNumber", rnumber},
+	} {
+		if f[1] != "" {
+			fmt.Fprintf(&fields, "<urn:%s>%s</urn:%s>", f[0], xmlEscape(f[1]), f[0])
+		}
+	}
+
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+		<soapenv:Envelope
+			xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"
+			xmlns:urn="urn:ec.europa.eu:taxud:vies:services:checkVat:types">
+			<soapenv:Header/>
+			<soapenv:Body>
+				<urn:checkVatApprox>%s</urn:checkVatApprox>
+			</soapenv:Body>
+		</soapenv:Envelope>`, fields.String())
+
+	env, err := c.callVIES(OpCheckVatApprox, country+number, body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := env.Body.Approx
+	if r == nil {
+		return nil, c.onError(errors.New("vies: empty checkVatApprox response"))
+	}
+
+	return &VIESResult{
+		CountryCode:       r.CountryCode,
+		VATNumber:         r.VATNumber,
+		RequestDate:       r.RequestDate,
+		Valid:             r.Valid,
+		Name:              viesValue(r.Name),
+		Address:           viesValue(r.Address),
+		RequestIdentifier: r.RequestIdentifier,
+		CompanyType:       viesValue(r.CompanyType),
+		Street:            viesValue(r.Street),
+		Postcode:          viesValue(r.Postcode),
+		City:              viesValue(r.City),
+		NameMatch:         r.NameMatch,
+		CompanyTypeMatch:  r.CompanyTypeMatch,
+		StreetMatch:       r.StreetMatch,
+		PostcodeMatch:     r.PostcodeMatch,
+		CityMatch:         r.CityMatch,
+	}, nil
+}
+
+// callVIES posts an envelope to VIES, with the metrics and hooks of a GSIS call
+// faults come back with a 500 status, and are returned as a VIESError
+func (c *Client) callVIES(operation, calledfor, body string) (*viesEnvelope, error) {
+
+	c.onRequest(operation, "", calledfor)
+	start := time.Now()
+
+	var status int
+	var raw []byte
+	env := &viesEnvelope{}
+	resp, err := c.post(c.viesEndpoint(), "text/xml; charset=utf-8", body, env)
+	if resp != nil {
+		status, raw = resp.StatusCode, resp.Raw
+	}
+	if err == nil && status != http.StatusOK && env.Body.Fault == nil {
+		err = statusError(status, nil)
+	}
+	if err != nil {
+		c.Metrics.ObserveCall(operation, OutcomeError, "", time.Since(start))
+		return nil, c.onError(err)
+	}
+
+	if f := env.Body.Fault; f != nil {
+		code := strings.TrimSpace(f.String)
+		c.Metrics.ObserveCall(operation, OutcomeFault, code, time.Since(start))
+		return nil, c.onError(&VIESError{Code: code, Message: f.Code, Err: viesFaults[code]})
+	}
+
+	c.Metrics.ObserveCall(operation, OutcomeOK, "", time.Since(start))
+	c.onResponse(nil, raw, time.Since(start))
+	return env, nil
+}
+
+// viesNumber splits the country prefix off a number, VIES knows Greece as EL
+// without a country, it is taken from the number's prefix
+func viesNumber(country, number string) (string, string) {
+
+	number = strings.ToUpper(strings.Join(strings.Fields(number), ""))
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" && len(number) > 2 && isUpperASCII(number[0]) && isUpperASCII(number[1]) {
+		country = number[:2]
+	}
+	if country == "GR" {
+		country = "EL"
+	}
+
+	if country != "" && (strings.HasPrefix(number, country) || (country == "EL" && strings.HasPrefix(number, "GR"))) {
+		number = number[2:]
+	}
+
+	return country, number
+}
+
+func isUpperASCII(b byte) bool {
+	return b >= 'A' && b <= 'Z'
+}
+
+// viesValue drops the placeholder of undisclosed values
+func viesValue(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "---" {
+		return ""
+	}
+	return s
+}
+
+// xmlEscape escapes text for an xml element
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
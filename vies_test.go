@@ -0,0 +1,214 @@
+package rgwspublic
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testCheckVatResponse = `<env:Envelope xmlns:env="http://schemas.xmlsoap.org/soap/envelope/">
+	<env:Header/>
+	<env:Body>
+		<ns2:checkVatResponse xmlns:ns2="urn:ec.europa.eu:taxud:vies:services:checkVat:types">
+			<ns2:countryCode>DE</ns2:countryCode>
+			<ns2:vatNumber>123456788</ns2:vatNumber>
+			<ns2:requestDate>2024-05-02+02:00</ns2:requestDate>
+			<ns2:valid>true</ns2:valid>
+			<ns2:name>---</ns2:name>
+			<ns2:address>---</ns2:address>
+		</ns2:checkVatResponse>
+	</env:Body>
+</env:Envelope>`
+
+const testCheckVatApproxResponse = `<env:Envelope xmlns:env="http://schemas.xmlsoap.org/soap/envelope/">
+	<env:Header/>
+	<env:Body>
+		<ns2:checkVatApproxResponse xmlns:ns2="urn:ec.europa.eu:taxud:vies:services:checkVat:types">
+			<ns2:countryCode>EL</ns2:countryCode>
+			<ns2:vatNumber>094014298</ns2:vatNumber>
+			<ns2:requestDate>2024-05-02+02:00</ns2:requestDate>
+			<ns2:valid>true</ns2:valid>
+			<ns2:traderName>ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ</ns2:traderName>
+			<ns2:traderCompanyType>---</ns2:traderCompanyType>
+			<ns2:traderAddress>ΑΜΕΡΙΚΗΣ 4 10564 - ΑΘΗΝΑ</ns2:traderAddress>
+			<ns2:traderNameMatch>1</ns2:traderNameMatch>
+			<ns2:requestIdentifier>WAPIAAAAX1abcdEF</ns2:requestIdentifier>
+		</ns2:checkVatApproxResponse>
+	</env:Body>
+</env:Envelope>`
+
+func testVIESFault(code string) string {
+	return `<env:Envelope xmlns:env="http://schemas.xmlsoap.org/soap/envelope/">
+	<env:Header/>
+	<env:Body>
+		<env:Fault>
+			<faultcode>env:Server</faultcode>
+			<faultstring>` + code + `</faultstring>
+		</env:Fault>
+	</env:Body>
+</env:Envelope>`
+}
+
+func newTestVIESClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{HTTPClient: srv.Client(), VIESEndpoint: srv.URL, Metrics: NewMetrics()}
+}
+
+func TestCheckVat(t *testing.T) {
+
+	var sent string
+	c := newTestVIESClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		sent = string(b)
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "text/xml") {
+			t.Errorf("unexpected content type: %s", r.Header.Get("Content-Type"))
+		}
+		w.Write([]byte(testCheckVatResponse))
+	})
+
+	res, err := c.CheckVat("de", "DE 123 456 788")
+	if err != nil {
+		t.Fatalf("error checking vat: %s", err)
+	}
+
+	if !strings.Contains(sent, "<urn:countryCode>DE</urn:countryCode>") || !strings.Contains(sent, "<urn:vatNumber>123456788</urn:vatNumber>") {
+		t.Errorf("unexpected request: %s", sent)
+	}
+	if !res.Valid || res.CountryCode != "DE" || res.VATNumber != "123456788" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if res.Name != "" || res.Address != "" {
+		t.Errorf("undisclosed name and address should be empty: %+v", res)
+	}
+	if c.Metrics.Calls(OpCheckVat, OutcomeOK, "") != 1 {
+		t.Errorf("call not counted")
+	}
+}
+
+func TestCheckVatApprox(t *testing.T) {
+
+	var sent string
+	c := newTestVIESClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		sent = string(b)
+		w.Write([]byte(testCheckVatApproxResponse))
+	})
+
+	res, err := c.CheckVatApprox(VIESApproxRequest{
+		CountryCode:          "GR",
+		VATNumber:            "EL094014298",
+		TraderName:           "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ & ΣΙΑ",
+		RequesterCountryCode: "DE",
+		RequesterVATNumber:   "123456788",
+	})
+	if err != nil {
+		t.Fatalf("error checking vat: %s", err)
+	}
+
+	wanted := []string{
+		"<urn:countryCode>EL</urn:countryCode>",
+		"<urn:vatNumber>094014298</urn:vatNumber>",
+		"<urn:traderName>ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ &amp; ΣΙΑ</urn:traderName>",
+		"<urn:requesterVatNumber>123456788</urn:requesterVatNumber>",
+	}
+	for _, w := range wanted {
+		if !strings.Contains(sent, w) {
+			t.Errorf("request is missing %s", w)
+		}
+	}
+	if strings.Contains(sent, "traderCity") {
+		t.Errorf("empty fields should not be sent")
+	}
+
+	if res.RequestIdentifier != "WAPIAAAAX1abcdEF" || res.Name != "ΤΡΑΠΕΖΑ ΠΕΙΡΑΙΩΣ ΑΝΩΝΥΜΗ ΕΤΑΙΡΕΙΑ" ||
+		res.Address != "ΑΜΕΡΙΚΗΣ 4 10564 - ΑΘΗΝΑ" || res.NameMatch != "1" || res.CompanyType != "" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestCheckVatFaults(t *testing.T) {
+
+	faults := map[string]error{
+		"INVALID_INPUT":         ErrVIESInvalidInput,
+		"MS_UNAVAILABLE":        ErrVIESMSUnavailable,
+		"TIMEOUT":               ErrVIESTimeout,
+		"MS_MAX_CONCURRENT_REQ": ErrVIESConcurrentLimit,
+	}
+
+	for code, wanted := range faults {
+
+		var hookErr error
+		c := newTestVIESClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(testVIESFault(code)))
+		})
+		c.Hooks = HookFuncs{Error: func(err error) { hookErr = err }}
+
+		_, err := c.CheckVat("DE", "123456788")
+		if !errors.Is(err, wanted) {
+			t.Errorf("unexpected error for %s: %v", code, err)
+		}
+
+		var verr *VIESError
+		if !errors.As(err, &verr) || verr.Code != code {
+			t.Errorf("expected a VIESError for %s, got: %v", code, err)
+		} else if verr.Temporary() != (code != "INVALID_INPUT") {
+			t.Errorf("unexpected Temporary for %s", code)
+		}
+
+		if hookErr != err {
+			t.Errorf("error hook not called for %s", code)
+		}
+		if c.Metrics.Calls(OpCheckVat, OutcomeFault, code) != 1 {
+			t.Errorf("fault %s not counted", code)
+		}
+	}
+
+	// a 500 without a fault is an http error
+	c := newTestVIESClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("<html/>"))
+	})
+	_, err := c.CheckVat("DE", "123456788")
+	var verr *VIESError
+	if err == nil || errors.As(err, &verr) {
+		t.Errorf("expected an http error, got: %v", err)
+	}
+}
+
+func TestVIESNumber(t *testing.T) {
+
+	tests := []struct {
+		country, number string
+		wantCountry     string
+		wantNumber      string
+	}{
+		{"", "EL094014298", "EL", "094014298"},
+		{"", "gr 094 014 298", "EL", "094014298"},
+		{"", "DE123456789", "DE", "123456789"},
+		{"", "094014298", "", "094014298"},
+		{"GR", "EL094014298", "EL", "094014298"},
+		{"el", "GR094014298", "EL", "094014298"},
+		{"FR", "AB123456789", "FR", "AB123456789"},
+		{"FR", "FRAB123456789", "FR", "AB123456789"},
+	}
+
+	var c Client
+	if _, err := c.CheckVat("", "094014298"); !errors.Is(err, ErrVIESInvalidInput) {
+		t.Errorf("expected invalid input without a country, got: %v", err)
+	}
+
+	for _, tt := range tests {
+		country, number := viesNumber(tt.country, tt.number)
+		if country != tt.wantCountry || number != tt.wantNumber {
+			t.Errorf("viesNumber(%q, %q) = %q, %q, wanted: %q, %q", tt.country, tt.number, country, number, tt.wantCountry, tt.wantNumber)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package rgwspublic
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeKind is the kind of a registry change of a watched AFM
+type ChangeKind string
+
+const (
+	ChangeDeactivated  ChangeKind = "deactivated"   // DeactivationFlag became 2
+	ChangeReactivated  ChangeKind = "reactivated"   // DeactivationFlag became 1
+	ChangeStopped      ChangeKind = "stopped"       // StopDate was set
+	ChangeAddress      ChangeKind = "address"       // postal address changed
+	ChangeMainActivity ChangeKind = "main_activity" // main (ΚΥΡΙΑ) activity changed
+)
+
+// ChangeEvent is emitted when a watched AFM changes
+type ChangeEvent struct {
+	AFM  string     `json:"afm"`
+	Kind ChangeKind `json:"kind"`
+	Old  string     `json:"old"`
+	New  string     `json:"new"`
+	Time time.Time  `json:"time"`
+	Info *VATInfo   `json:"info,omitempty"` // the new snapshot
+}
+
+// Changes compares two snapshots of the same AFM and returns the watched changes
+// flags and dates are compared trimmed, addresses and activities in their NormalizeGreek form,
+// the events hold the values as returned
+func Changes(old, new *VATInfo) []ChangeEvent {
+
+	var events []ChangeEvent
+	add := func(kind ChangeKind, o, n string) {
+		events = append(events, ChangeEvent{AFM: strings.TrimSpace(new.Result.AFM), Kind: kind, Old: o, New: n, Info: new})
+	}
+
+	o, n := strings.TrimSpace(old.Result.DeactivationFlag), strings.TrimSpace(new.Result.DeactivationFlag)
+	if o != n {
+		switch n {
+		case "2":
+			add(ChangeDeactivated, o, n)
+		case "1":
+			add(ChangeReactivated, o, n)
+		}
+	}
+
+	o, n = strings.TrimSpace(old.Result.StopDate), strings.TrimSpace(new.Result.StopDate)
+	if o != n && n != "" {
+		add(ChangeStopped, o, n)
+	}
+
+	if o, n := postalAddress(old), postalAddress(new); NormalizeGreek(o) != NormalizeGreek(n) {
+		add(ChangeAddress, o, n)
+	}
+
+	if o, n := mainActivity(old), mainActivity(new); NormalizeGreek(o) != NormalizeGreek(n) {
+		add(ChangeMainActivity, o, n)
+	}
+
+	return events
+}
+
+// postalAddress formats the address of a record in one line
+func postalAddress(i *VATInfo) string {
+	street := strings.TrimSpace(strings.TrimSpace(i.Result.PostalAddress) + " " + strings.TrimSpace(i.Result.PostalAddressNo))
+	area := strings.TrimSpace(strings.TrimSpace(i.Result.PostalZipCode) + " " + strings.TrimSpace(i.Result.PostalAreaDescription))
+	return strings.Trim(street+", "+area, ", ")
+}
+
+// mainActivity formats the main activity of a record, code and description
+func mainActivity(i *VATInfo) string {
+	for _, a := range i.Activities {
+		if a.Kind == 1 {
+			return strings.TrimSpace(strings.TrimSpace(a.Descriptionn) + " (" + strconv.Itoa(a.Code) + ")")
+		}
+	}
+	return ""
+}
+
+// WatchEntry is the state of a watched AFM
+type WatchEntry struct {
+	AFM      string    `json:"afm"`
+	Checked  time.Time `json:"checked,omitempty"`
+	Snapshot *VATInfo  `json:"snapshot,omitempty"`
+	Error    string    `json:"error,omitempty"` // of the last check
+}
+
+// Watchlist is a list of AFMs and their last snapshots, stored in a json file
+type Watchlist struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]*WatchEntry
+	day     string // of used
+	used    int    // lookups made on day
+}
+
+type watchlistFile struct {
+	Entries []*WatchEntry `json:"entries"`
+	Day     string        `json:"day,omitempty"`
+	Used    int           `json:"used,omitempty"`
+}
+
+// OpenWatchlist loads the watchlist stored at path, or an empty one if it doesn't exist
+func OpenWatchlist(path string) (*Watchlist, error) {
+
+	w := &Watchlist{path: path, entries: map[string]*WatchEntry{}}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := watchlistFile{}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+
+	for _, e := range f.Entries {
+		w.entries[e.AFM] = e
+	}
+	w.day, w.used = f.Day, f.Used
+
+	return w, nil
+}
+
+// Add AFMs to watch
+func (w *Watchlist) Add(afms ...string) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, afm := range afms {
+		afm = strings.TrimSpace(afm)
+		if _, ok := w.entries[afm]; !ok {
+			w.entries[afm] = &WatchEntry{AFM: afm}
+		}
+	}
+}
+
+// Remove AFMs from the watchlist
+func (w *Watchlist) Remove(afms ...string) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, afm := range afms {
+		delete(w.entries, strings.TrimSpace(afm))
+	}
+}
+
+// Entries returns a copy of the watched entries, sorted by AFM
+func (w *Watchlist) Entries() []WatchEntry {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entries := make([]WatchEntry, 0, len(w.entries))
+	for _, e := range w.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].AFM < entries[j].AFM })
+
+	return entries
+}
+
+// Save writes the watchlist to its file
+func (w *Watchlist) Save() error {
+
+	w.mu.Lock()
+	f := watchlistFile{Day: w.day, Used: w.used}
+	for _, e := range w.entries {
+		f.Entries = append(f.Entries, e)
+	}
+	sort.Slice(f.Entries, func(i, j int) bool { return f.Entries[i].AFM < f.Entries[j].AFM })
+	b, err := json.MarshalIndent(f, "", "  ")
+	w.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(w.path, b)
+}
+
+// writeFileAtomic replaces a file, so a crash never leaves it half written
+func writeFileAtomic(path string, b []byte) error {
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Monitor re-checks the AFMs of a watchlist and emits change events
+type Monitor struct {
+	// Client used for lookups, with a credentials provider
+	Client *Client
+
+	// List of watched AFMs
+	List *Watchlist
+
+	// Interval between checks of the same AFM, a day if zero
+	Interval time.Duration
+
+	// DailyBudget of lookups, unlimited if zero
+	// AFMs not checked for longest go first
+	DailyBudget int
+
+	// Sinks receive every change event
+	Sinks []EventSink
+
+	// OnError is called for failed lookups and sinks, can be nil
+	OnError func(afm string, err error)
+
+	now func() time.Time
+}
+
+// RunOnce checks the AFMs due, within budget, and returns the changes found
+// the first check of an AFM only stores its snapshot
+func (m *Monitor) RunOnce() ([]ChangeEvent, error) {
+
+	now := m.clock()
+	interval := m.Interval
+	if interval == 0 {
+		interval = 24 * time.Hour
+	}
+
+	// AFMs due, oldest check first
+	due := []WatchEntry{}
+	for _, e := range m.List.Entries() {
+		if e.Checked.IsZero() || !now.Before(e.Checked.Add(interval)) {
+			due = append(due, e)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].Checked.Before(due[j].Checked) })
+
+	var events []ChangeEvent
+	for _, e := range due {
+
+		if !m.spend(now) {
+			break
+		}
+
+		info, err := m.Client.Lookup("", e.AFM)
+		m.update(e.AFM, now, info, err)
+		if err != nil {
+			m.error(e.AFM, err)
+			continue
+		}
+
+		if e.Snapshot == nil {
+			continue
+		}
+
+		for _, ev := range Changes(e.Snapshot, info) {
+			ev.AFM, ev.Time = e.AFM, now
+			events = append(events, ev)
+			for _, s := range m.Sinks {
+				if err := s.Emit(ev); err != nil {
+					m.error(e.AFM, err)
+				}
+			}
+		}
+	}
+
+	return events, m.List.Save()
+}
+
+// Run calls RunOnce every tick until ctx is done
+func (m *Monitor) Run(ctx context.Context, tick time.Duration) error {
+
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	for {
+		if _, err := m.RunOnce(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// spend takes one lookup from the daily budget, if any is left
+func (m *Monitor) spend(now time.Time) bool {
+
+	w := m.List
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	day := now.Format("2006-01-02")
+	if w.day != day {
+		w.day, w.used = day, 0
+	}
+
+	if m.DailyBudget > 0 && w.used >= m.DailyBudget {
+		return false
+	}
+
+	w.used++
+	if m.DailyBudget > 0 {
+		m.Client.Metrics.SetQuotaRemaining(int64(m.DailyBudget - w.used))
+	}
+
+	return true
+}
+
+// update stores the result of a check
+func (m *Monitor) update(afm string, now time.Time, info *VATInfo, err error) {
+
+	w := m.List
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e, ok := w.entries[afm]
+	if !ok {
+		return // removed meanwhile
+	}
+
+	e.Checked = now
+	e.Error = ""
+	if err != nil {
+		e.Error = err.Error()
+		return
+	}
+	e.Snapshot = info
+}
+
+func (m *Monitor) error(afm string, err error) {
+	if m.OnError != nil {
+		m.OnError(afm, err)
+	}
+}
+
+func (m *Monitor) clock() time.Time {
+	if m.now == nil {
+		return time.Now()
+	}
+	return m.now()
+}
@@ -0,0 +1,187 @@
+package rgwspublic
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the mock response after the company was deactivated, moved and changed main activity
+var testChangedResponse = strings.NewReplacer(
+	"<deactivation_flag>1</deactivation_flag>", "<deactivation_flag>2</deactivation_flag>",
+	`<stop_date xsi:nil="true"/>`, "<stop_date>2022-03-01+02:00</stop_date>",
+	"<postal_address_no>4</postal_address_no>", "<postal_address_no>6</postal_address_no>",
+	"<firm_act_kind>1</firm_act_kind>", "<firm_act_kind>3</firm_act_kind>",
+	"<firm_act_kind>2</firm_act_kind>", "<firm_act_kind>1</firm_act_kind>",
+).Replace(testVATInfoResponse)
+
+func TestMonitor(t *testing.T) {
+
+	dir := t.TempDir()
+	body := testVATInfoResponse
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		respond(body)(w, r)
+	})
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+
+	// a receiver failing the first delivery
+	secret := []byte("webhook secret")
+	deliveries := 0
+	var delivered ChangeEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deliveries++
+		b, _ := ioutil.ReadAll(r.Body)
+		sig := SignWebhook(secret, r.Header.Get(WebhookTimestampHeader), b)
+		if !hmac.Equal([]byte(sig), []byte(r.Header.Get(WebhookSignatureHeader))) {
+			t.Errorf("invalid webhook signature")
+		}
+		if deliveries == 1 {
+			http.Error(w, "try again", http.StatusBadGateway)
+			return
+		}
+		json.Unmarshal(b, &delivered)
+	}))
+	defer hook.Close()
+
+	list, err := OpenWatchlist(filepath.Join(dir, "watchlist.json"))
+	if err != nil {
+		t.Fatalf("error opening watchlist: %s", err)
+	}
+	list.Add("094014298")
+
+	var called []ChangeKind
+	now := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+	m := &Monitor{
+		Client: c,
+		List:   list,
+		Sinks: []EventSink{
+			SinkFunc(func(e ChangeEvent) error {
+				called = append(called, e.Kind)
+				return nil
+			}),
+			&JSONLSink{Path: filepath.Join(dir, "events.jsonl")},
+			&WebhookSink{URL: hook.URL, Secret: secret, Retries: 1, Backoff: time.Millisecond},
+		},
+		OnError: func(afm string, err error) {
+			t.Errorf("unexpected error for %s: %s", afm, err)
+		},
+		now: func() time.Time { return now },
+	}
+
+	// first check stores a snapshot
+	if events, err := m.RunOnce(); err != nil || len(events) != 0 {
+		t.Fatalf("unexpected first run: %v, error: %v", events, err)
+	}
+
+	// not due again yet
+	body = testChangedResponse
+	now = now.Add(time.Hour)
+	if events, _ := m.RunOnce(); len(events) != 0 {
+		t.Fatalf("unexpected events before interval: %v", events)
+	}
+
+	now = now.Add(24 * time.Hour)
+	events, err := m.RunOnce()
+	if err != nil {
+		t.Fatalf("error running monitor: %s", err)
+	}
+
+	wanted := []ChangeKind{ChangeDeactivated, ChangeStopped, ChangeAddress, ChangeMainActivity}
+	if len(called) != len(wanted) || len(events) != len(wanted) {
+		t.Fatalf("unexpected events: %v", called)
+	}
+	for i := range wanted {
+		if called[i] != wanted[i] {
+			t.Errorf("unexpected event #%d, got: %s, wanted: %s", i, called[i], wanted[i])
+		}
+	}
+
+	if events[2].Old != "ΑΜΕΡΙΚΗΣ 4, 10564 ΑΘΗΝΑ" || events[2].New != "ΑΜΕΡΙΚΗΣ 6, 10564 ΑΘΗΝΑ" {
+		t.Errorf("unexpected address change: %+v", events[2])
+	}
+	if events[3].New != "ΥΠΗΡΕΣΙΕΣ ΜΕΣΙΤΩΝ ΧΡΗΜΑΤΙΣΤΗΡΙΟΥ (66191000)" {
+		t.Errorf("unexpected main activity change: %+v", events[3])
+	}
+
+	if deliveries != 5 || delivered.Kind != ChangeMainActivity {
+		t.Errorf("unexpected webhook deliveries: %d, last: %s", deliveries, delivered.Kind)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "events.jsonl"))
+	if err != nil {
+		t.Fatalf("error opening events file: %s", err)
+	}
+	defer f.Close()
+	lines := 0
+	for s := bufio.NewScanner(f); s.Scan(); lines++ {
+	}
+	if lines != 4 {
+		t.Errorf("unexpected lines in events file: %d", lines)
+	}
+
+	// the snapshot is persisted
+	list, err = OpenWatchlist(filepath.Join(dir, "watchlist.json"))
+	if err != nil {
+		t.Fatalf("error reopening watchlist: %s", err)
+	}
+	if e := list.Entries(); len(e) != 1 || e[0].Snapshot.Result.DeactivationFlag != "2" {
+		t.Errorf("unexpected stored entries: %+v", e)
+	}
+}
+
+func TestMonitorBudget(t *testing.T) {
+
+	lookups := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		respond(testVATInfoResponse)(w, r)
+	})
+	c.Credentials = StaticCredentials{Username: "username", Password: "password"}
+	c.Metrics = NewMetrics()
+
+	list, _ := OpenWatchlist(filepath.Join(t.TempDir(), "watchlist.json"))
+	list.Add("094014298", "094019245", "090165560")
+
+	now := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+	m := &Monitor{Client: c, List: list, DailyBudget: 2, now: func() time.Time { return now }}
+
+	m.RunOnce()
+	m.RunOnce()
+	if lookups != 2 {
+		t.Errorf("budget not respected, lookups: %d", lookups)
+	}
+
+	// the AFM left out goes first the next day
+	now = now.Add(24 * time.Hour)
+	m.DailyBudget = 1
+	m.RunOnce()
+	for _, e := range list.Entries() {
+		if e.Checked.IsZero() {
+			t.Errorf("%s never checked", e.AFM)
+		}
+	}
+}
+
+func TestChangesNormalized(t *testing.T) {
+
+	old := testSnapshot(t, testVATInfoResponse)
+	new := testSnapshot(t, strings.Replace(testVATInfoResponse,
+		"<postal_area_description>ΑΘΗΝΑ</postal_area_description>", "<postal_area_description>Αθήνα</postal_area_description>", 1))
+	if events := Changes(old, new); len(events) != 0 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+
+	new.Result.PostalAreaDescription = "ΠΕΙΡΑΙΑΣ"
+	events := Changes(old, new)
+	if len(events) != 1 || events[0].Kind != ChangeAddress || !strings.HasSuffix(events[0].Old, "ΑΘΗΝΑ") {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}